@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// 2 段階認証の途中（パスワードは通った）ことを示すトークン。
+// aud で区別し、sid を持たないので API のアクセストークンとしては使えない
+const (
+	challengeAudience = "login-2fa"
+	ChallengeTTL      = 5 * time.Minute
+)
+
+func IssueChallengeToken(userID string) (string, error) {
+	k, err := currentKeyring()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	return k.sign(jwt.RegisteredClaims{
+		Issuer:    "freemarket-backend",
+		Subject:   userID,
+		Audience:  jwt.ClaimStrings{challengeAudience},
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(ChallengeTTL)),
+	})
+}
+
+// 有効なチャレンジなら userId を返す
+func VerifyChallengeToken(tokenString string) (string, error) {
+	k, err := currentKeyring()
+	if err != nil {
+		return "", err
+	}
+
+	claims := &jwt.RegisteredClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, k.keyFunc,
+		jwt.WithValidMethods([]string{"HS256", "RS256", "EdDSA"}),
+		jwt.WithAudience(challengeAudience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return "", err
+	}
+	if !token.Valid || claims.Subject == "" {
+		return "", errors.New("invalid challenge token")
+	}
+	return claims.Subject, nil
+}
@@ -107,7 +107,8 @@ func GenerateProductSummary(p domain.Product) (string, error) {
 	prompt := fmt.Sprintf(
 		`以下の商品について、購入検討者向けに短く紹介してください。
 
-
+【商品名】%s
+【価格】%d円
 【説明】%s
 
 条件：
@@ -2,42 +2,67 @@ package auth
 
 import (
 	"errors"
+	"log"
+	"os"
+	"slices"
+	"strconv"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
-var jwtSecret = []byte("dev-secret-change-me") // 後で環境変数にする
+const defaultAccessTokenMinutes = 15
+
+// アクセストークンの有効期限（ACCESS_TOKEN_TTL_MINUTES）。切れたら /token/refresh で取り直す
+func AccessTokenTTL() time.Duration {
+	minutes := defaultAccessTokenMinutes
+	if v := os.Getenv("ACCESS_TOKEN_TTL_MINUTES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			log.Println("⚠️ invalid ACCESS_TOKEN_TTL_MINUTES, using default:", v)
+		} else {
+			minutes = n
+		}
+	}
+	return time.Duration(minutes) * time.Minute
+}
 
 type Claims struct {
-	UserID string `json:"userId"`
+	UserID    string `json:"userId"`
+	SessionID string `json:"sid"` // ログインごとのセッション。失効はこれ単位
 	jwt.RegisteredClaims
 }
 
-func IssueToken(userID string) (string, error) {
+func IssueToken(userID, sessionID string) (string, error) {
 	now := time.Now()
 	claims := Claims{
-		UserID: userID,
+		UserID:    userID,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			Issuer:    "freemarket-backend",
 			Subject:   userID,
 			IssuedAt:  jwt.NewNumericDate(now),
-			ExpiresAt: jwt.NewNumericDate(now.Add(24 * time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(now.Add(AccessTokenTTL())),
 		},
 	}
 
-	t := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return t.SignedString(jwtSecret)
+	k, err := currentKeyring()
+	if err != nil {
+		return "", err
+	}
+	return k.sign(claims)
 }
 
 func VerifyToken(tokenString string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (any, error) {
-		// 署名方式チェック（事故防止）
-		if token.Method != jwt.SigningMethodHS256 {
-			return nil, errors.New("unexpected signing method")
-		}
-		return jwtSecret, nil
-	})
+	k, err := currentKeyring()
+	if err != nil {
+		return nil, err
+	}
+
+	// kid の鍵で検証する。キーリングに残っている鍵なら署名用でなくても通す（ローテーション中）
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, k.keyFunc,
+		jwt.WithValidMethods([]string{"HS256", "RS256", "EdDSA"}),
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -46,5 +71,10 @@ func VerifyToken(tokenString string) (*Claims, error) {
 	if !ok || !token.Valid {
 		return nil, errors.New("invalid token")
 	}
+	// 2 段階認証のチャレンジは API には使えない
+	// sid の無いトークン（セッション導入前に発行）は元の期限（24 時間）までそのまま通す
+	if slices.Contains(claims.Audience, challengeAudience) {
+		return nil, errors.New("invalid token")
+	}
 	return claims, nil
 }
@@ -0,0 +1,320 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ===== JWT 署名鍵 =====
+//
+// JWT_KEYS_FILE（JSON ファイル）か JWT_KEYS（同じ JSON をそのまま）で鍵を並べる:
+//
+//	[
+//	  {"kid": "2026-10", "alg": "EdDSA", "privateKeyFile": "/secrets/jwt-ed25519.pem"},
+//	  {"kid": "2026-04", "alg": "RS256", "publicKeyFile": "/secrets/jwt-rsa.pub.pem"},
+//	  {"kid": "legacy",  "alg": "HS256", "secret": "..."}
+//	]
+//
+// 署名に使うのは JWT_SIGNING_KID（省略時は先頭）。残りは検証だけに使うので、
+// 新しい鍵を先頭に足して古い鍵を後ろに残せば、発行済みのトークンを失効させずに入れ替えられる。
+// 公開鍵だけの鍵は検証専用。
+//
+// 1 本だけでよければ JWT_SECRET（HS256, kid "default"）でもよい。
+// どちらも無ければ開発用の固定鍵を使う（Cloud Run 上では起動しない）。
+//
+// kid の無いトークン（キーリング導入前に JWT_SECRET で発行したもの）は kid "default" の
+// HS256 鍵で検証する。JWT_KEYS に移るときは旧 JWT_SECRET を kid "default" で残しておく。
+
+const devSecret = "dev-secret-change-me"
+
+// kid の無いトークンを検証する鍵（前から順に探す）
+var legacyKIDs = []string{"default", "dev"}
+
+var (
+	ErrUnknownKey      = errors.New("unknown signing key")
+	ErrKeyringNotReady = errors.New("keyring not loaded")
+)
+
+type keyConfig struct {
+	KID            string `json:"kid"`
+	Alg            string `json:"alg"` // HS256 | RS256 | EdDSA
+	Secret         string `json:"secret,omitempty"`
+	PrivateKey     string `json:"privateKey,omitempty"` // PEM をそのまま
+	PrivateKeyFile string `json:"privateKeyFile,omitempty"`
+	PublicKey      string `json:"publicKey,omitempty"`
+	PublicKeyFile  string `json:"publicKeyFile,omitempty"`
+}
+
+type signingKey struct {
+	kid       string
+	method    jwt.SigningMethod
+	signKey   any // nil なら検証専用
+	verifyKey any
+}
+
+type Keyring struct {
+	signing *signingKey
+	legacy  *signingKey // kid の無いトークン用。無ければ nil
+	keys    map[string]*signingKey
+	order   []string // JWKS の並び順
+}
+
+var (
+	ringMu sync.RWMutex
+	ring   *Keyring
+)
+
+// 起動時に 1 回呼ぶ。設定が壊れていたらエラー
+func LoadKeyring() error {
+	k, err := keyringFromEnv()
+	if err != nil {
+		return err
+	}
+	ringMu.Lock()
+	ring = k
+	ringMu.Unlock()
+	log.Printf("JWT keyring loaded: signing kid=%s, %d key(s)", k.signing.kid, len(k.keys))
+	return nil
+}
+
+func currentKeyring() (*Keyring, error) {
+	ringMu.RLock()
+	defer ringMu.RUnlock()
+	if ring == nil {
+		return nil, ErrKeyringNotReady
+	}
+	return ring, nil
+}
+
+func keyringFromEnv() (*Keyring, error) {
+	var raw []byte
+	switch {
+	case os.Getenv("JWT_KEYS_FILE") != "":
+		b, err := os.ReadFile(os.Getenv("JWT_KEYS_FILE"))
+		if err != nil {
+			return nil, fmt.Errorf("read JWT_KEYS_FILE: %w", err)
+		}
+		raw = b
+	case os.Getenv("JWT_KEYS") != "":
+		raw = []byte(os.Getenv("JWT_KEYS"))
+	}
+
+	var cfgs []keyConfig
+	if raw != nil {
+		if err := json.Unmarshal(raw, &cfgs); err != nil {
+			return nil, fmt.Errorf("parse JWT keys: %w", err)
+		}
+	} else if s := os.Getenv("JWT_SECRET"); s != "" {
+		cfgs = []keyConfig{{KID: "default", Alg: "HS256", Secret: s}}
+	} else {
+		if os.Getenv("K_SERVICE") != "" {
+			return nil, errors.New("no JWT keys configured (set JWT_KEYS_FILE, JWT_KEYS or JWT_SECRET)")
+		}
+		log.Println("⚠️ no JWT keys configured, using dev secret")
+		cfgs = []keyConfig{{KID: "dev", Alg: "HS256", Secret: devSecret}}
+	}
+
+	return newKeyring(cfgs, os.Getenv("JWT_SIGNING_KID"))
+}
+
+func newKeyring(cfgs []keyConfig, signingKID string) (*Keyring, error) {
+	if len(cfgs) == 0 {
+		return nil, errors.New("JWT keyring is empty")
+	}
+	if signingKID == "" {
+		signingKID = cfgs[0].KID
+	}
+
+	k := &Keyring{keys: map[string]*signingKey{}}
+	for _, c := range cfgs {
+		if c.KID == "" {
+			return nil, errors.New("JWT key without kid")
+		}
+		if _, dup := k.keys[c.KID]; dup {
+			return nil, fmt.Errorf("duplicate JWT kid %q", c.KID)
+		}
+		sk, err := parseKey(c)
+		if err != nil {
+			return nil, fmt.Errorf("JWT key %q: %w", c.KID, err)
+		}
+		k.keys[c.KID] = sk
+		k.order = append(k.order, c.KID)
+	}
+
+	for _, kid := range legacyKIDs {
+		if sk := k.keys[kid]; sk != nil && sk.method == jwt.SigningMethodHS256 {
+			k.legacy = sk
+			break
+		}
+	}
+
+	k.signing = k.keys[signingKID]
+	if k.signing == nil {
+		return nil, fmt.Errorf("JWT_SIGNING_KID %q not in keyring", signingKID)
+	}
+	if k.signing.signKey == nil {
+		return nil, fmt.Errorf("JWT key %q has no private key and cannot sign", signingKID)
+	}
+	return k, nil
+}
+
+func parseKey(c keyConfig) (*signingKey, error) {
+	sk := &signingKey{kid: c.KID}
+
+	switch c.Alg {
+	case "HS256":
+		if c.Secret == "" {
+			return nil, errors.New("HS256 needs secret")
+		}
+		sk.method = jwt.SigningMethodHS256
+		sk.signKey, sk.verifyKey = []byte(c.Secret), []byte(c.Secret)
+		return sk, nil
+
+	case "RS256":
+		sk.method = jwt.SigningMethodRS256
+		if priv, err := readPEM(c.PrivateKey, c.PrivateKeyFile); err != nil {
+			return nil, err
+		} else if priv != nil {
+			key, err := jwt.ParseRSAPrivateKeyFromPEM(priv)
+			if err != nil {
+				return nil, err
+			}
+			sk.signKey, sk.verifyKey = key, &key.PublicKey
+			return sk, nil
+		}
+		pub, err := readPEM(c.PublicKey, c.PublicKeyFile)
+		if err != nil || pub == nil {
+			return nil, errors.New("RS256 needs privateKey or publicKey")
+		}
+		key, err := jwt.ParseRSAPublicKeyFromPEM(pub)
+		if err != nil {
+			return nil, err
+		}
+		sk.verifyKey = key
+		return sk, nil
+
+	case "EdDSA":
+		sk.method = jwt.SigningMethodEdDSA
+		if priv, err := readPEM(c.PrivateKey, c.PrivateKeyFile); err != nil {
+			return nil, err
+		} else if priv != nil {
+			key, err := jwt.ParseEdPrivateKeyFromPEM(priv)
+			if err != nil {
+				return nil, err
+			}
+			edKey, ok := key.(ed25519.PrivateKey)
+			if !ok {
+				return nil, errors.New("not an Ed25519 private key")
+			}
+			sk.signKey, sk.verifyKey = edKey, edKey.Public()
+			return sk, nil
+		}
+		pub, err := readPEM(c.PublicKey, c.PublicKeyFile)
+		if err != nil || pub == nil {
+			return nil, errors.New("EdDSA needs privateKey or publicKey")
+		}
+		key, err := jwt.ParseEdPublicKeyFromPEM(pub)
+		if err != nil {
+			return nil, err
+		}
+		sk.verifyKey = key
+		return sk, nil
+	}
+
+	return nil, fmt.Errorf("unsupported alg %q", c.Alg)
+}
+
+// inline が優先。どちらも無ければ nil
+func readPEM(inline, file string) ([]byte, error) {
+	if inline != "" {
+		return []byte(inline), nil
+	}
+	if file != "" {
+		return os.ReadFile(file)
+	}
+	return nil, nil
+}
+
+func (k *Keyring) sign(claims jwt.Claims) (string, error) {
+	t := jwt.NewWithClaims(k.signing.method, claims)
+	t.Header["kid"] = k.signing.kid
+	return t.SignedString(k.signing.signKey)
+}
+
+// kid で鍵を選ぶ。alg が鍵の種類と違えば弾く（alg 差し替え攻撃の防止）
+func (k *Keyring) keyFunc(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	sk := k.keys[kid]
+	if kid == "" {
+		sk = k.legacy
+	}
+	if sk == nil {
+		return nil, ErrUnknownKey
+	}
+	if token.Method.Alg() != sk.method.Alg() {
+		return nil, errors.New("unexpected signing method")
+	}
+	return sk.verifyKey, nil
+}
+
+// ===== JWKS =====
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// 公開鍵だけを返す。HS256 の共有鍵は外に出せないので載せない
+func JWKS() (JWKSet, error) {
+	k, err := currentKeyring()
+	if err != nil {
+		return JWKSet{}, err
+	}
+
+	set := JWKSet{Keys: []JWK{}}
+	for _, kid := range k.order {
+		sk := k.keys[kid]
+		if jwk, ok := publicJWK(sk.kid, sk.method.Alg(), sk.verifyKey); ok {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	return set, nil
+}
+
+func publicJWK(kid, alg string, key crypto.PublicKey) (JWK, bool) {
+	b64 := base64.RawURLEncoding.EncodeToString
+	switch pub := key.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			Kty: "RSA", Kid: kid, Alg: alg, Use: "sig",
+			N: b64(pub.N.Bytes()),
+			E: b64(big.NewInt(int64(pub.E)).Bytes()),
+		}, true
+	case ed25519.PublicKey:
+		return JWK{Kty: "OKP", Kid: kid, Alg: alg, Use: "sig", Crv: "Ed25519", X: b64(pub)}, true
+	}
+	return JWK{}, false
+}
@@ -0,0 +1,277 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func rsaKeyPEM(t *testing.T) (priv, pub string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return encodePEM(t, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key)),
+		encodePublicPEM(t, &key.PublicKey)
+}
+
+func ed25519KeyPEM(t *testing.T) (priv, pub string) {
+	t.Helper()
+	pubKey, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return encodePEM(t, "PRIVATE KEY", der), encodePublicPEM(t, pubKey)
+}
+
+func encodePublicPEM(t *testing.T, key any) string {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return encodePEM(t, "PUBLIC KEY", der)
+}
+
+func encodePEM(t *testing.T, typ string, der []byte) string {
+	t.Helper()
+	return string(pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}))
+}
+
+func mustKeyring(t *testing.T, cfgs []keyConfig, signingKID string) *Keyring {
+	t.Helper()
+	k, err := newKeyring(cfgs, signingKID)
+	if err != nil {
+		t.Fatalf("newKeyring: %v", err)
+	}
+	return k
+}
+
+func testClaims() Claims {
+	now := time.Now()
+	return Claims{
+		UserID:    "u_1",
+		SessionID: "s_1",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "u_1",
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+		},
+	}
+}
+
+func verifyWith(k *Keyring, token string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(token, claims, k.keyFunc,
+		jwt.WithValidMethods([]string{"HS256", "RS256", "EdDSA"}),
+	)
+	return claims, err
+}
+
+func TestSignVerify(t *testing.T) {
+	rsaPriv, _ := rsaKeyPEM(t)
+	edPriv, _ := ed25519KeyPEM(t)
+
+	tests := []struct {
+		name string
+		cfg  keyConfig
+	}{
+		{"HS256", keyConfig{KID: "hs", Alg: "HS256", Secret: "s3cret"}},
+		{"RS256", keyConfig{KID: "rs", Alg: "RS256", PrivateKey: rsaPriv}},
+		{"EdDSA", keyConfig{KID: "ed", Alg: "EdDSA", PrivateKey: edPriv}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := mustKeyring(t, []keyConfig{tt.cfg}, "")
+
+			token, err := k.sign(testClaims())
+			if err != nil {
+				t.Fatalf("sign: %v", err)
+			}
+			parsed, _, err := jwt.NewParser().ParseUnverified(token, &Claims{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if parsed.Header["kid"] != tt.cfg.KID || parsed.Method.Alg() != tt.cfg.Alg {
+				t.Errorf("header kid=%v alg=%v, want %s %s", parsed.Header["kid"], parsed.Method.Alg(), tt.cfg.KID, tt.cfg.Alg)
+			}
+
+			claims, err := verifyWith(k, token)
+			if err != nil {
+				t.Fatalf("verify: %v", err)
+			}
+			if claims.UserID != "u_1" || claims.SessionID != "s_1" {
+				t.Errorf("claims = %+v", claims)
+			}
+		})
+	}
+}
+
+// 新しい鍵を先頭に足しても、古い鍵で署名済みのトークンは検証できる
+func TestRotationKeepsOldTokensValid(t *testing.T) {
+	oldPriv, oldPub := rsaKeyPEM(t)
+	newPriv, _ := ed25519KeyPEM(t)
+
+	before := mustKeyring(t, []keyConfig{
+		{KID: "2026-04", Alg: "RS256", PrivateKey: oldPriv},
+	}, "")
+	oldToken, err := before.sign(testClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	after := mustKeyring(t, []keyConfig{
+		{KID: "2026-10", Alg: "EdDSA", PrivateKey: newPriv},
+		{KID: "2026-04", Alg: "RS256", PublicKey: oldPub}, // 検証専用で残す
+	}, "")
+	if _, err := verifyWith(after, oldToken); err != nil {
+		t.Errorf("old token after rotation: %v", err)
+	}
+
+	newToken, err := after.sign(testClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifyWith(after, newToken); err != nil {
+		t.Errorf("new token: %v", err)
+	}
+	if _, err := verifyWith(before, newToken); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("new token on old keyring = %v, want ErrUnknownKey", err)
+	}
+
+	// 古い鍵を外したら通らない
+	retired := mustKeyring(t, []keyConfig{
+		{KID: "2026-10", Alg: "EdDSA", PrivateKey: newPriv},
+	}, "")
+	if _, err := verifyWith(retired, oldToken); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("old token after removing key = %v, want ErrUnknownKey", err)
+	}
+}
+
+func TestSigningKIDSelectsKey(t *testing.T) {
+	k := mustKeyring(t, []keyConfig{
+		{KID: "a", Alg: "HS256", Secret: "secret-a"},
+		{KID: "b", Alg: "HS256", Secret: "secret-b"},
+	}, "b")
+	if k.signing.kid != "b" {
+		t.Errorf("signing kid = %s, want b", k.signing.kid)
+	}
+
+	_, pub := rsaKeyPEM(t)
+	if _, err := newKeyring([]keyConfig{{KID: "pub", Alg: "RS256", PublicKey: pub}}, ""); err == nil {
+		t.Error("verify-only key accepted as signing key")
+	}
+	if _, err := newKeyring([]keyConfig{{KID: "a", Alg: "HS256", Secret: "x"}}, "missing"); err == nil {
+		t.Error("unknown JWT_SIGNING_KID accepted")
+	}
+}
+
+// kid の指す鍵と違う alg のトークンは、署名が合っていても弾く
+func TestAlgMismatchRejected(t *testing.T) {
+	_, rsaPub := rsaKeyPEM(t)
+	edPriv, _ := ed25519KeyPEM(t)
+
+	k := mustKeyring(t, []keyConfig{
+		{KID: "ed", Alg: "EdDSA", PrivateKey: edPriv},
+		{KID: "rs", Alg: "RS256", PublicKey: rsaPub},
+		{KID: "hs", Alg: "HS256", Secret: "s3cret"},
+	}, "ed")
+
+	sign := func(method jwt.SigningMethod, kid string, key any) string {
+		t.Helper()
+		tok := jwt.NewWithClaims(method, testClaims())
+		tok.Header["kid"] = kid
+		s, err := tok.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		// RS256 の公開鍵（公開されている）を HS256 の共有鍵として使う古典的な攻撃
+		{"HS256 with RSA public key", sign(jwt.SigningMethodHS256, "rs", []byte(rsaPub))},
+		{"HS256 token claiming EdDSA kid", sign(jwt.SigningMethodHS256, "ed", []byte("s3cret"))},
+		{"none", sign(jwt.SigningMethodNone, "hs", jwt.UnsafeAllowNoneSignatureType)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := verifyWith(k, tt.token); err == nil {
+				t.Error("token accepted")
+			}
+		})
+	}
+}
+
+// キーリング導入前の kid 無しトークンは kid "default"（JWT_SECRET）で検証する
+func TestKidlessTokenUsesDefaultKey(t *testing.T) {
+	legacy := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims())
+	token, err := legacy.SignedString([]byte("old-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	edPriv, _ := ed25519KeyPEM(t)
+	tests := []struct {
+		name string
+		cfgs []keyConfig
+		ok   bool
+	}{
+		{"JWT_SECRET", []keyConfig{{KID: "default", Alg: "HS256", Secret: "old-secret"}}, true},
+		{"rotated with default kept", []keyConfig{
+			{KID: "2026-10", Alg: "EdDSA", PrivateKey: edPriv},
+			{KID: "default", Alg: "HS256", Secret: "old-secret"},
+		}, true},
+		{"default has a different secret", []keyConfig{{KID: "default", Alg: "HS256", Secret: "new-secret"}}, false},
+		{"no default key", []keyConfig{{KID: "2026-10", Alg: "EdDSA", PrivateKey: edPriv}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := verifyWith(mustKeyring(t, tt.cfgs, ""), token)
+			if (err == nil) != tt.ok {
+				t.Errorf("verify = %v, want ok=%v", err, tt.ok)
+			}
+		})
+	}
+}
+
+// IssueToken / VerifyToken を環境変数の設定から通す
+func TestIssueAndVerifyTokenFromEnv(t *testing.T) {
+	t.Setenv("JWT_KEYS", `[{"kid":"2026-10","alg":"HS256","secret":"new"},{"kid":"default","alg":"HS256","secret":"old"}]`)
+	t.Setenv("JWT_SIGNING_KID", "")
+	if err := LoadKeyring(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		ringMu.Lock()
+		ring = nil
+		ringMu.Unlock()
+	})
+
+	token, err := IssueToken("u_1", "s_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := VerifyToken(token)
+	if err != nil {
+		t.Fatalf("VerifyToken: %v", err)
+	}
+	if claims.UserID != "u_1" || claims.SessionID != "s_1" {
+		t.Errorf("claims = %+v", claims)
+	}
+}
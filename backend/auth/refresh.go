@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+const defaultRefreshTokenDays = 30
+
+// リフレッシュトークンの有効期限（REFRESH_TOKEN_TTL_DAYS）。使うたびに新しいものに入れ替わる
+func RefreshTokenTTL() time.Duration {
+	days := defaultRefreshTokenDays
+	if v := os.Getenv("REFRESH_TOKEN_TTL_DAYS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			log.Println("⚠️ invalid REFRESH_TOKEN_TTL_DAYS, using default:", v)
+		} else {
+			days = n
+		}
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// クライアントに渡す生のトークンと、DB に保存するハッシュ
+func NewRefreshToken() (token, hash string, err error) {
+	return newOpaqueToken()
+}
+
+// パスワード再設定メールに載せるトークン。DB にはハッシュだけ置く
+func NewPasswordResetToken() (token, hash string, err error) {
+	return newOpaqueToken()
+}
+
+func newOpaqueToken() (token, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, HashToken(token), nil
+}
+
+// 十分にランダムなので bcrypt ではなく SHA-256 で引けるようにしておく
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -1,5 +1,173 @@
+-- MySQL（Cloud SQL）と SQLite の両方で流す。
+-- MySQL は TEXT 列を主キーや索引にできないので、そこに使う列は VARCHAR にする（ID 64、日時 40、状態 32）。
+-- これより前からある products / messages / likes も、索引に入る列は同じ長さの VARCHAR で作ってあること
+
 CREATE TABLE IF NOT EXISTS users (
-                                     id TEXT PRIMARY KEY,
+                                     id VARCHAR(64) PRIMARY KEY,
                                      password_hash TEXT NOT NULL,
-                                     created_at TEXT NOT NULL
-);
\ No newline at end of file
+                                     created_at VARCHAR(40) NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS orders (
+                                      id VARCHAR(64) PRIMARY KEY,
+                                      product_id VARCHAR(64) NOT NULL,
+                                      buyer_id VARCHAR(64) NOT NULL,
+                                      seller_id VARCHAR(64) NOT NULL,
+                                      price INTEGER NOT NULL,
+                                      status VARCHAR(32) NOT NULL,
+                                      created_at VARCHAR(40) NOT NULL,
+                                      updated_at VARCHAR(40) NOT NULL
+);
+CREATE INDEX idx_orders_buyer ON orders(buyer_id, created_at);
+CREATE INDEX idx_orders_seller ON orders(seller_id, created_at);
+
+ALTER TABLE orders ADD COLUMN payment_intent_id VARCHAR(128);
+CREATE INDEX idx_orders_payment_intent ON orders(payment_intent_id);
+
+CREATE TABLE IF NOT EXISTS escrow_ledger (
+                                             order_id VARCHAR(64) PRIMARY KEY,
+                                             buyer_id VARCHAR(64) NOT NULL,
+                                             seller_id VARCHAR(64) NOT NULL,
+                                             amount INTEGER NOT NULL,
+                                             status VARCHAR(32) NOT NULL,
+                                             held_at VARCHAR(40) NOT NULL,
+                                             release_after VARCHAR(40),
+                                             settled_at VARCHAR(40)
+);
+CREATE INDEX idx_escrow_seller ON escrow_ledger(seller_id, status);
+CREATE INDEX idx_escrow_buyer ON escrow_ledger(buyer_id, status);
+CREATE INDEX idx_escrow_due ON escrow_ledger(status, release_after);
+
+ALTER TABLE products ADD COLUMN deleted_at VARCHAR(40);
+
+ALTER TABLE messages ADD COLUMN read_at VARCHAR(40);
+CREATE INDEX idx_messages_to_time ON messages(to_user_id, created_at);
+
+CREATE INDEX idx_messages_unread ON messages(to_user_id, read_at);
+
+CREATE INDEX idx_messages_thread_time ON messages(product_id, from_user_id, to_user_id, created_at);
+
+CREATE TABLE IF NOT EXISTS attachments (
+                                           id VARCHAR(64) PRIMARY KEY,
+                                           uploader_id VARCHAR(64) NOT NULL,
+                                           message_id VARCHAR(64),
+                                           content_type TEXT NOT NULL,
+                                           size INTEGER NOT NULL,
+                                           storage_key TEXT NOT NULL,
+                                           created_at VARCHAR(40) NOT NULL
+);
+CREATE INDEX idx_attachments_message ON attachments(message_id);
+
+CREATE TABLE IF NOT EXISTS images (
+                                      id VARCHAR(64) PRIMARY KEY,
+                                      owner_id VARCHAR(64) NOT NULL,
+                                      width INTEGER NOT NULL,
+                                      height INTEGER NOT NULL,
+                                      created_at VARCHAR(40) NOT NULL
+);
+ALTER TABLE products ADD COLUMN image_id VARCHAR(64);
+
+CREATE TABLE IF NOT EXISTS product_images (
+                                              product_id VARCHAR(64) NOT NULL,
+                                              image_id VARCHAR(64) NOT NULL,
+                                              position INTEGER NOT NULL,
+                                              is_cover BOOLEAN NOT NULL DEFAULT FALSE,
+                                              PRIMARY KEY (product_id, image_id)
+);
+CREATE INDEX idx_product_images_order ON product_images(product_id, position);
+
+ALTER TABLE products ADD COLUMN buyer_id VARCHAR(64);
+CREATE INDEX idx_products_seller ON products(seller_id, created_at);
+
+CREATE TABLE IF NOT EXISTS reviews (
+                                       order_id VARCHAR(64) NOT NULL,
+                                       reviewer_id VARCHAR(64) NOT NULL,
+                                       reviewee_id VARCHAR(64) NOT NULL,
+                                       reviewer_role VARCHAR(32) NOT NULL,
+                                       rating INTEGER NOT NULL,
+                                       comment TEXT NOT NULL,
+                                       created_at VARCHAR(40) NOT NULL,
+                                       PRIMARY KEY (order_id, reviewer_id)
+);
+CREATE INDEX idx_reviews_reviewee ON reviews(reviewee_id, created_at);
+
+CREATE TABLE IF NOT EXISTS offers (
+                                      id VARCHAR(64) PRIMARY KEY,
+                                      product_id VARCHAR(64) NOT NULL,
+                                      buyer_id VARCHAR(64) NOT NULL,
+                                      seller_id VARCHAR(64) NOT NULL,
+                                      price INTEGER NOT NULL,
+                                      status VARCHAR(32) NOT NULL,
+                                      proposed_by VARCHAR(64) NOT NULL,
+                                      expires_at VARCHAR(40) NOT NULL,
+                                      reserved_until VARCHAR(40),
+                                      created_at VARCHAR(40) NOT NULL,
+                                      updated_at VARCHAR(40) NOT NULL
+);
+CREATE INDEX idx_offers_product ON offers(product_id, status);
+CREATE INDEX idx_offers_buyer ON offers(buyer_id, created_at);
+CREATE INDEX idx_offers_seller ON offers(seller_id, created_at);
+
+CREATE TABLE IF NOT EXISTS quote_requests (
+                                              product_id VARCHAR(64) NOT NULL,
+                                              requester_id VARCHAR(64) NOT NULL,
+                                              message TEXT NOT NULL,
+                                              created_at VARCHAR(40) NOT NULL,
+                                              notified_at VARCHAR(40),
+                                              PRIMARY KEY (product_id, requester_id)
+);
+
+CREATE TABLE IF NOT EXISTS sessions (
+                                        id VARCHAR(64) PRIMARY KEY,
+                                        user_id VARCHAR(64) NOT NULL,
+                                        created_at VARCHAR(40) NOT NULL,
+                                        revoked_at VARCHAR(40)
+);
+CREATE INDEX idx_sessions_user ON sessions(user_id);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+                                              token_hash VARCHAR(64) PRIMARY KEY,
+                                              session_id VARCHAR(64) NOT NULL,
+                                              user_id VARCHAR(64) NOT NULL,
+                                              expires_at VARCHAR(40) NOT NULL,
+                                              used_at VARCHAR(40),
+                                              created_at VARCHAR(40) NOT NULL
+);
+CREATE INDEX idx_refresh_tokens_session ON refresh_tokens(session_id);
+
+CREATE TABLE IF NOT EXISTS login_failures (
+                                              user_id VARCHAR(64) NOT NULL,
+                                              ip VARCHAR(45) NOT NULL,
+                                              reason VARCHAR(32) NOT NULL,
+                                              created_at VARCHAR(40) NOT NULL
+);
+CREATE INDEX idx_login_failures_user ON login_failures(user_id, created_at);
+CREATE INDEX idx_login_failures_ip ON login_failures(ip, created_at);
+
+CREATE TABLE IF NOT EXISTS user_totp (
+                                         user_id VARCHAR(64) PRIMARY KEY,
+                                         secret TEXT NOT NULL,
+                                         confirmed_at VARCHAR(40),
+                                         last_step BIGINT NOT NULL DEFAULT 0,
+                                         created_at VARCHAR(40) NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+                                              user_id VARCHAR(64) NOT NULL,
+                                              code_hash VARCHAR(64) NOT NULL,
+                                              created_at VARCHAR(40) NOT NULL,
+                                              used_at VARCHAR(40),
+                                              PRIMARY KEY (user_id, code_hash)
+);
+
+ALTER TABLE users ADD COLUMN email VARCHAR(254);
+CREATE UNIQUE INDEX idx_users_email ON users(email);
+
+CREATE TABLE IF NOT EXISTS password_resets (
+                                               token_hash VARCHAR(64) PRIMARY KEY,
+                                               user_id VARCHAR(64) NOT NULL,
+                                               expires_at VARCHAR(40) NOT NULL,
+                                               used_at VARCHAR(40),
+                                               created_at VARCHAR(40) NOT NULL
+);
+CREATE INDEX idx_password_resets_user ON password_resets(user_id, created_at);
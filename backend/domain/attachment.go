@@ -0,0 +1,13 @@
+package domain
+
+// チャットに添付する画像
+type Attachment struct {
+	ID          string `json:"id"`
+	UploaderID  string `json:"uploaderId"`
+	MessageID   string `json:"messageId,omitempty"` // 送信前は空
+	ContentType string `json:"contentType"`
+	Size        int64  `json:"size"`
+	StorageKey  string `json:"-"`
+	URL         string `json:"url"`
+	CreatedAt   string `json:"createdAt"`
+}
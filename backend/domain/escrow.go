@@ -0,0 +1,35 @@
+package domain
+
+// エスクロー（預かり金）のステータス
+const (
+	EscrowHeld     = "held"
+	EscrowReleased = "released"
+	EscrowRefunded = "refunded"
+)
+
+// 注文ごとに運営が預かっているお金
+type EscrowEntry struct {
+	OrderID      string `json:"orderId"`
+	BuyerID      string `json:"buyerId"`
+	SellerID     string `json:"sellerId"`
+	Amount       int    `json:"amount"`
+	Status       string `json:"status"`
+	HeldAt       string `json:"heldAt"`
+	ReleaseAfter string `json:"releaseAfter,omitempty"` // 発送時にセット。過ぎたら自動で出品者へ
+	SettledAt    string `json:"settledAt,omitempty"`
+}
+
+// ユーザーごとの残高。トップレベルは出品者として受け取る売上
+type Balance struct {
+	Held     int `json:"held"`     // 預かり中（受取確認 / 自動解放待ち）
+	Released int `json:"released"` // 解放済み
+
+	AsBuyer BuyerBalance `json:"asBuyer"`
+}
+
+// 購入者として支払ったお金の行き先
+type BuyerBalance struct {
+	Held     int `json:"held"`     // 運営が預かっている
+	Released int `json:"released"` // 出品者へ渡った
+	Refunded int `json:"refunded"` // 返金された
+}
@@ -0,0 +1,21 @@
+package domain
+
+// 出品用にアップロードされた画像（サムネイル / 詳細の 2 サイズを持つ）
+type Image struct {
+	ID        string `json:"id"`
+	OwnerID   string `json:"ownerId"`
+	Width     int    `json:"width"` // detail の大きさ
+	Height    int    `json:"height"`
+	ThumbURL  string `json:"thumbUrl"`
+	DetailURL string `json:"detailUrl"`
+	CreatedAt string `json:"createdAt"`
+}
+
+// 商品に並べる画像 1 枚
+type ProductImage struct {
+	ImageID   string `json:"imageId,omitempty"` // 旧データ（imageUrl だけ）の場合は空
+	Position  int    `json:"position"`
+	IsCover   bool   `json:"isCover"`
+	ThumbURL  string `json:"thumbUrl"`
+	DetailURL string `json:"detailUrl"`
+}
@@ -7,4 +7,26 @@ type Message struct {
 	ToUserID   string `json:"toUserId"`
 	Body       string `json:"body"`
 	CreatedAt  string `json:"createdAt"`
+	ReadAt     string `json:"readAt,omitempty"` // 受信側が既読にした時刻
+
+	Attachments []Attachment `json:"attachments,omitempty"`
+}
+
+// 受信箱の 1 スレッド（商品 × 相手）
+type InboxThread struct {
+	ProductID      string `json:"productId"`
+	ProductTitle   string `json:"productTitle"`
+	OtherUserID    string `json:"otherUserId"`
+	OtherUserName  string `json:"otherUserName"`
+	LastMessage    string `json:"lastMessage"` // プレビュー（先頭だけ）
+	LastFromUserID string `json:"lastFromUserId"`
+	LastMessageAt  string `json:"lastMessageAt"`
+	UnreadCount    int    `json:"unreadCount"`
+}
+
+// スレッドごとの未読数
+type UnreadCount struct {
+	ProductID   string `json:"productId"`
+	OtherUserID string `json:"otherUserId"`
+	Count       int    `json:"count"`
 }
@@ -0,0 +1,26 @@
+package domain
+
+// 値下げ交渉（オファー）のステータス
+const (
+	OfferPending  = "pending" // 相手の返答待ち
+	OfferAccepted = "accepted"
+	OfferRejected = "rejected"
+	OfferExpired  = "expired"
+)
+
+// 買い手が出した希望価格。出品者が逆提案すると同じオファーの金額と提案者が入れ替わる
+type Offer struct {
+	ID         string `json:"id"`
+	ProductID  string `json:"productId"`
+	BuyerID    string `json:"buyerId"`
+	SellerID   string `json:"sellerId"`
+	Price      int    `json:"price"`
+	Status     string `json:"status"`
+	ProposedBy string `json:"proposedBy"` // 今の金額を出した側。返答できるのはもう一方
+	ExpiresAt  string `json:"expiresAt"`
+	CreatedAt  string `json:"createdAt"`
+	UpdatedAt  string `json:"updatedAt"`
+
+	// 承諾後、この時刻まではこの買い手だけがこの金額で購入できる
+	ReservedUntil string `json:"reservedUntil,omitempty"`
+}
@@ -0,0 +1,49 @@
+package domain
+
+// 取引（注文）のステータス
+const (
+	OrderPendingPayment = "pending_payment"
+	OrderPaid           = "paid"
+	OrderShipped        = "shipped"
+	OrderReceived       = "received"
+	OrderCompleted      = "completed"
+	OrderCancelled      = "cancelled"
+)
+
+type Order struct {
+	ID        string `json:"id"`
+	ProductID string `json:"productId"`
+	BuyerID   string `json:"buyerId"`
+	SellerID  string `json:"sellerId"`
+	Price     int    `json:"price"`
+	Status    string `json:"status"`
+	CreatedAt string `json:"createdAt"`
+	UpdatedAt string `json:"updatedAt"`
+
+	PaymentIntentID string `json:"paymentIntentId,omitempty"`
+}
+
+// 売上 / 購入履歴用。注文に商品の表示情報を付けたもの
+type OrderSummary struct {
+	Order
+	ProductTitle    string `json:"productTitle"`
+	ProductImageURL string `json:"productImageUrl"`
+	ProductImageID  string `json:"-"` // URL は返すときに組み立てる
+}
+
+// 許可する状態遷移（from → to）
+var orderTransitions = map[string][]string{
+	OrderPendingPayment: {OrderPaid, OrderCancelled},
+	OrderPaid:           {OrderShipped, OrderCancelled},
+	OrderShipped:        {OrderReceived},
+	OrderReceived:       {OrderCompleted},
+}
+
+func CanTransitionOrder(from, to string) bool {
+	for _, s := range orderTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
@@ -6,9 +6,31 @@ type Product struct {
 	Price       int    `json:"price"`
 	Description string `json:"description"`
 	SellerID    string `json:"sellerId"`
+	BuyerID     string `json:"buyerId,omitempty"` // 売れた商品だけ。出品者と買い手にだけ返す（公開の一覧・詳細では空）
 	Status      string `json:"status"`
+	Deleted     bool   `json:"deleted,omitempty"` // 出品者が削除済み。取引の当事者にだけ返す
 	CreatedAt   string `json:"createdAt"`
 	ImageURL    string `json:"imageUrl"`
+	ImageID     string `json:"imageId,omitempty"` // POST /uploads で上げた画像。あれば imageUrl はそこから作る
 	LikeCount   int    `json:"likeCount"`
 	LikedByMe   bool   `json:"likedByMe"`
+
+	// 並び順どおり。imageUrl はカバー画像（互換のため残す）
+	Images []ProductImage `json:"images"`
+}
+
+// 出品者が手動で切り替えられるステータス（from → to）
+// sold は購入でしか付かず、ここからは戻せない
+var productTransitions = map[string][]string{
+	"considering": {"available"},
+	"available":   {"considering"},
+}
+
+func CanTransitionProduct(from, to string) bool {
+	for _, s := range productTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,10 @@
+package domain
+
+// 価格未定（considering）の出品への「値段を知りたい」リクエスト
+type QuoteRequest struct {
+	ProductID   string `json:"productId"`
+	RequesterID string `json:"requesterId"`
+	Message     string `json:"message"`
+	CreatedAt   string `json:"createdAt"`
+	NotifiedAt  string `json:"notifiedAt,omitempty"` // 価格が決まって通知した時刻
+}
@@ -0,0 +1,17 @@
+package domain
+
+// 取引後の評価。1 注文につき買い手・売り手がそれぞれ 1 件ずつ
+type Review struct {
+	OrderID      string `json:"orderId"`
+	ReviewerID   string `json:"reviewerId"`
+	RevieweeID   string `json:"revieweeId"`
+	ReviewerRole string `json:"reviewerRole"` // "buyer" | "seller"
+	Rating       int    `json:"rating"`       // 1〜5
+	Comment      string `json:"comment"`
+	CreatedAt    string `json:"createdAt"`
+}
+
+// 受取確認が済んだ取引だけ評価できる
+func CanReviewOrder(status string) bool {
+	return status == OrderReceived || status == OrderCompleted
+}
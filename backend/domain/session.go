@@ -0,0 +1,9 @@
+package domain
+
+// ログイン 1 回ぶんのセッション。リフレッシュトークンはこの単位でローテーションする
+type Session struct {
+	ID        string `json:"id"`
+	UserID    string `json:"userId"`
+	CreatedAt string `json:"createdAt"`
+	RevokedAt string `json:"revokedAt,omitempty"`
+}
@@ -0,0 +1,10 @@
+package domain
+
+// ユーザーの TOTP 設定。ConfirmedAt が入るまでは登録途中で、ログインでは要求しない
+type TOTP struct {
+	UserID      string `json:"userId"`
+	Secret      string `json:"-"`
+	ConfirmedAt string `json:"confirmedAt,omitempty"`
+	LastStep    int64  `json:"-"` // 最後に使ったステップ。同じコードの再利用を防ぐ
+	CreatedAt   string `json:"createdAt"`
+}
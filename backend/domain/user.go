@@ -5,5 +5,15 @@ type User struct {
 	PasswordHash string `json:"-"` // 絶対返さない
 	DisplayName  string `json:"displayName"`
 	MBTI         string `json:"mbti"`
+	Email        string `json:"-"` // パスワード再設定の送り先。本人にだけ /me で返す
 	CreatedAt    string `json:"createdAt"`
 }
+
+// 他のユーザーに見せてよいプロフィール
+type PublicProfile struct {
+	UserID      string   `json:"userId"`
+	DisplayName string   `json:"displayName"`
+	MBTI        string   `json:"mbti"`
+	Rating      *float64 `json:"rating"` // 評価がまだ無ければ null
+	ReviewCount int      `json:"reviewCount"`
+}
@@ -0,0 +1,84 @@
+package escrow
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"freemarket-backend/domain"
+	"freemarket-backend/repository"
+)
+
+const defaultAutoReleaseDays = 7
+
+// 発送から何日で購入者の受取確認なしに出品者へ解放するか（ESCROW_AUTO_RELEASE_DAYS）
+func AutoReleaseAfter() time.Duration {
+	days := defaultAutoReleaseDays
+	if v := os.Getenv("ESCROW_AUTO_RELEASE_DAYS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			log.Println("⚠️ invalid ESCROW_AUTO_RELEASE_DAYS, using default:", v)
+		} else {
+			days = n
+		}
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// 期限切れの預かりを引く側と、受取確認（状態の変更と解放を 1 トランザクション）をする側
+type dueLister interface {
+	ListDue(now time.Time) ([]domain.EscrowEntry, error)
+}
+
+type receiver interface {
+	Receive(orderID string, now time.Time) error
+}
+
+type AutoReleaser struct {
+	ledger dueLister
+	orders receiver
+	now    func() time.Time
+}
+
+// now が nil なら time.Now
+func NewAutoReleaser(ledger *repository.LedgerRepository, orders *repository.OrderRepository, now func() time.Time) *AutoReleaser {
+	return newAutoReleaser(ledger, orders, now)
+}
+
+func newAutoReleaser(ledger dueLister, orders receiver, now func() time.Time) *AutoReleaser {
+	if now == nil {
+		now = time.Now
+	}
+	return &AutoReleaser{ledger: ledger, orders: orders, now: now}
+}
+
+// interval ごとに期限切れの預かりを解放し続ける（goroutine で呼ぶ）
+func (a *AutoReleaser) Run(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		a.RunOnce()
+		<-t.C
+	}
+}
+
+// 受取確認の代わりに received にして出品者へ解放する。shipped のものだけなので、
+// 途中で落ちても次の回に同じ注文を二重に解放しない
+func (a *AutoReleaser) RunOnce() {
+	now := a.now()
+	due, err := a.ledger.ListDue(now)
+	if err != nil {
+		log.Println("escrow ListDue error:", err)
+		return
+	}
+
+	for _, e := range due {
+		if err := a.orders.Receive(e.OrderID, now); err != nil {
+			log.Println("escrow auto release error:", e.OrderID, err)
+			continue
+		}
+		log.Println("escrow auto released:", e.OrderID)
+	}
+}
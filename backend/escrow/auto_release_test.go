@@ -0,0 +1,123 @@
+package escrow
+
+import (
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"freemarket-backend/domain"
+	"freemarket-backend/repository"
+)
+
+// 注文と預かりをメモリで持つ。Receive は OrderRepository と同じく shipped の注文だけを
+// received にして、預かりを同時に released にする
+type fakeStore struct {
+	orders map[string]string // order id → status
+	ledger map[string]domain.EscrowEntry
+	calls  int
+}
+
+func (s *fakeStore) ListDue(now time.Time) ([]domain.EscrowEntry, error) {
+	var out []domain.EscrowEntry
+	for _, e := range s.ledger {
+		if e.Status == domain.EscrowHeld && e.ReleaseAfter != "" && e.ReleaseAfter <= now.Format(time.RFC3339) {
+			out = append(out, e)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ReleaseAfter < out[j].ReleaseAfter })
+	return out, nil
+}
+
+func (s *fakeStore) Receive(orderID string, now time.Time) error {
+	s.calls++
+	if s.orders[orderID] != domain.OrderShipped {
+		return repository.ErrInvalidOrderTransition
+	}
+	e := s.ledger[orderID]
+	if e.Status != domain.EscrowHeld {
+		return repository.ErrEscrowNotHeld
+	}
+	s.orders[orderID] = domain.OrderReceived
+	e.Status, e.SettledAt = domain.EscrowReleased, now.Format(time.RFC3339)
+	s.ledger[orderID] = e
+	return nil
+}
+
+func TestRunOnce(t *testing.T) {
+	start := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	now := start
+	clock := func() time.Time { return now }
+
+	s := &fakeStore{
+		orders: map[string]string{
+			"o_due":     domain.OrderShipped,
+			"o_not_due": domain.OrderShipped,
+			"o_paid":    domain.OrderPaid, // まだ発送していない → 期限なし
+		},
+		ledger: map[string]domain.EscrowEntry{
+			"o_due":     {OrderID: "o_due", Status: domain.EscrowHeld, ReleaseAfter: start.Add(-time.Minute).Format(time.RFC3339)},
+			"o_not_due": {OrderID: "o_not_due", Status: domain.EscrowHeld, ReleaseAfter: start.Add(time.Hour).Format(time.RFC3339)},
+			"o_paid":    {OrderID: "o_paid", Status: domain.EscrowHeld},
+		},
+	}
+	a := newAutoReleaser(s, s, clock)
+
+	a.RunOnce()
+	want := map[string]string{
+		"o_due":     domain.EscrowReleased,
+		"o_not_due": domain.EscrowHeld,
+		"o_paid":    domain.EscrowHeld,
+	}
+	for id, status := range want {
+		if got := s.ledger[id].Status; got != status {
+			t.Errorf("after first run: %s escrow = %s, want %s", id, got, status)
+		}
+	}
+	if s.orders["o_due"] != domain.OrderReceived {
+		t.Errorf("o_due order = %s, want received", s.orders["o_due"])
+	}
+
+	// 同じ時刻にもう一度回しても、解放済みのものは対象にならない
+	calls := s.calls
+	a.RunOnce()
+	if s.calls != calls {
+		t.Errorf("second run called Receive %d more times, want 0", s.calls-calls)
+	}
+
+	// 期限を過ぎたら残りも解放される
+	now = start.Add(time.Hour)
+	a.RunOnce()
+	if got := s.ledger["o_not_due"].Status; got != domain.EscrowReleased {
+		t.Errorf("o_not_due after its deadline = %s, want released", got)
+	}
+	if got := s.ledger["o_paid"].Status; got != domain.EscrowHeld {
+		t.Errorf("o_paid = %s, want held", got)
+	}
+}
+
+// 受取確認が失敗した注文は解放されず、次の回にまた試す
+func TestRunOnceRetriesFailedReceive(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	s := &fakeStore{
+		orders: map[string]string{"o_1": domain.OrderShipped},
+		ledger: map[string]domain.EscrowEntry{
+			"o_1": {OrderID: "o_1", Status: domain.EscrowHeld, ReleaseAfter: now.Format(time.RFC3339)},
+		},
+	}
+	failing := receiverFunc(func(string, time.Time) error { return errors.New("db down") })
+
+	newAutoReleaser(s, failing, func() time.Time { return now }).RunOnce()
+	if got := s.ledger["o_1"].Status; got != domain.EscrowHeld {
+		t.Fatalf("after failed receive = %s, want held", got)
+	}
+
+	newAutoReleaser(s, s, func() time.Time { return now }).RunOnce()
+	if got := s.ledger["o_1"].Status; got != domain.EscrowReleased {
+		t.Errorf("after retry = %s, want released", got)
+	}
+}
+
+type receiverFunc func(orderID string, now time.Time) error
+
+func (f receiverFunc) Receive(orderID string, now time.Time) error { return f(orderID, now) }
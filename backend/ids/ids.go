@@ -0,0 +1,127 @@
+package ids
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ULID 形式の ID を作る
+//
+//	<prefix>_<10文字: ミリ秒タイムスタンプ><16文字: 乱数>
+//
+// Crockford base32 なので文字列のまま並べると作成順になる。
+// 同じミリ秒内では乱数部を +1 して順序を保つ（monotonic）。
+//
+// 既存データの "p_HHMMSS" や "m_HHMMSS.000000000" はそのまま有効。
+// 列の型（VARCHAR(64)）はそのまま、書き換えも不要（Valid は両方の形式を受け付ける）。
+
+const encoding = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+const ulidLen = 26
+
+var (
+	mu       sync.Mutex
+	lastMs   uint64
+	lastRand [10]byte
+)
+
+// New("p") → "p_01J9Z3..."
+func New(prefix string) string {
+	return prefix + "_" + newULID(time.Now())
+}
+
+func newULID(t time.Time) string {
+	ms := uint64(t.UnixMilli())
+
+	mu.Lock()
+	var r [10]byte
+	if ms <= lastMs {
+		// 同じ（or 時計が戻った）ミリ秒 → 前回の乱数 +1
+		ms = lastMs
+		r = lastRand
+		for i := len(r) - 1; i >= 0; i-- {
+			r[i]++
+			if r[i] != 0 {
+				break
+			}
+		}
+	} else {
+		if _, err := rand.Read(r[:]); err != nil {
+			panic("ids: crypto/rand failed: " + err.Error())
+		}
+	}
+	lastMs, lastRand = ms, r
+	mu.Unlock()
+
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], ms<<16)
+	copy(b[6:], r[:])
+
+	return encode(b)
+}
+
+// 128bit → 26文字
+func encode(b [16]byte) string {
+	out := make([]byte, ulidLen)
+	hi := binary.BigEndian.Uint64(b[:8])
+	lo := binary.BigEndian.Uint64(b[8:])
+	for i := ulidLen - 1; i >= 0; i-- {
+		out[i] = encoding[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out)
+}
+
+// ULID 部分から作成時刻を取り出す。旧形式の ID なら ok=false
+func Time(id string) (time.Time, bool) {
+	i := strings.LastIndexByte(id, '_')
+	s := id[i+1:]
+	if len(s) != ulidLen {
+		return time.Time{}, false
+	}
+
+	var ms uint64
+	for _, c := range s[:10] {
+		v := strings.IndexRune(encoding, c)
+		if v < 0 {
+			return time.Time{}, false
+		}
+		ms = ms<<5 | uint64(v)
+	}
+	return time.UnixMilli(int64(ms)), true
+}
+
+// prefix 付きの ID として受け付けてよいか（新旧どちらの形式も OK）
+func Valid(prefix, id string) bool {
+	rest, ok := strings.CutPrefix(id, prefix+"_")
+	if !ok || rest == "" {
+		return false
+	}
+	if isULID(rest) {
+		return true
+	}
+	// 旧形式: 時刻を元にした数字と '.'
+	for _, c := range rest {
+		if (c < '0' || c > '9') && c != '.' {
+			return false
+		}
+	}
+	return true
+}
+
+// 26 文字すべてが Crockford base32 で、128bit に収まる（先頭は 0〜7）
+func isULID(s string) bool {
+	if len(s) != ulidLen || s[0] > '7' {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if strings.IndexByte(encoding, s[i]) < 0 {
+			return false
+		}
+	}
+	return true
+}
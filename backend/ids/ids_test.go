@@ -0,0 +1,107 @@
+package ids
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 前のテストで進んだ時計の記録を消す（過去の時刻で作ると前回の続きにされるので）
+func resetMonotonic() {
+	mu.Lock()
+	lastMs = 0
+	mu.Unlock()
+}
+
+func TestNewULIDSameMillisecondIsOrdered(t *testing.T) {
+	resetMonotonic()
+	at := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	// 同じミリ秒で続けて作っても、文字列のまま並べれば作った順
+	const n = 1000
+	got := make([]string, n)
+	for i := range got {
+		got[i] = newULID(at)
+	}
+	// 次のミリ秒に進んだ分も後ろに並ぶ
+	got = append(got, newULID(at.Add(time.Millisecond)))
+
+	for i := 1; i < len(got); i++ {
+		if got[i-1] >= got[i] {
+			t.Fatalf("ids[%d] = %s is not before ids[%d] = %s", i-1, got[i-1], i, got[i])
+		}
+	}
+	if !sort.StringsAreSorted(got) {
+		t.Fatal("ids are not sorted")
+	}
+
+	for i, id := range got {
+		want := at
+		if i == n {
+			want = at.Add(time.Millisecond)
+		}
+		if ts, ok := Time("p_" + id); !ok || !ts.Equal(want) {
+			t.Fatalf("Time(%s) = %v, %v, want %v", id, ts, ok, want)
+		}
+	}
+}
+
+// 時計が戻っても前の ID より後ろになる
+func TestNewULIDClockGoesBack(t *testing.T) {
+	resetMonotonic()
+	at := time.Date(2026, 10, 1, 12, 0, 1, 0, time.UTC)
+	a := newULID(at)
+	b := newULID(at.Add(-time.Second))
+	if a >= b {
+		t.Fatalf("%s is not before %s", a, b)
+	}
+}
+
+func TestNew(t *testing.T) {
+	id := New("p")
+	if !strings.HasPrefix(id, "p_") || len(id) != len("p_")+ulidLen {
+		t.Fatalf("New(\"p\") = %q", id)
+	}
+	if !Valid("p", id) {
+		t.Errorf("Valid(\"p\", %q) = false", id)
+	}
+	if ts, ok := Time(id); !ok || time.Since(ts) > time.Minute || time.Until(ts) > time.Minute {
+		t.Errorf("Time(%q) = %v, %v", id, ts, ok)
+	}
+}
+
+func TestValid(t *testing.T) {
+	tests := []struct {
+		prefix, id string
+		want       bool
+	}{
+		// ULID
+		{"p", "p_01J9Z3K4M5N6P7Q8R9S0T1V2W3", true},
+		{"img", "img_7ZZZZZZZZZZZZZZZZZZZZZZZZZ", true},
+		// 旧形式
+		{"p", "p_153012", true},
+		{"m", "m_153012.123456789", true},
+
+		{"p", "", false},
+		{"p", "p_", false},
+		{"p", "p", false},
+		{"p", "01J9Z3K4M5N6P7Q8R9S0T1V2W3", false},
+		{"p", "m_01J9Z3K4M5N6P7Q8R9S0T1V2W3", false},  // prefix 違い
+		{"p", "pp_01J9Z3K4M5N6P7Q8R9S0T1V2W3", false}, // prefix の後ろに余計な文字
+		{"p", "p_01J9Z3K4M5N6P7Q8R9S0T1V2W", false},   // 25 文字
+		{"p", "p_01J9Z3K4M5N6P7Q8R9S0T1V2W3X", false}, // 27 文字
+		{"p", "p_01j9z3k4m5n6p7q8r9s0t1v2w3", false},  // 小文字
+		{"p", "p_01J9Z3K4M5N6P7Q8R9S0T1V2WU", false},  // U は使わない
+		{"p", "p_01J9Z3K4M5N6P7Q8R9S0T1V!W3", false},  // 乱数部に記号
+		{"p", "p_8ZZZZZZZZZZZZZZZZZZZZZZZZZ", false},  // 128bit を超える
+		{"p", "p_../../etc/passwd", false},
+		{"p", "p_15:30:12", false},
+		{"p", "p_ 153012", false},
+	}
+	for _, tt := range tests {
+		if got := Valid(tt.prefix, tt.id); got != tt.want {
+			t.Errorf("Valid(%q, %q) = %v, want %v", tt.prefix, tt.id, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"slices"
+)
+
+var (
+	ErrUnsupportedFormat = errors.New("unsupported image format")
+	ErrTooLarge          = errors.New("image dimensions too large")
+)
+
+// 展開後のサイズ上限（解凍爆弾対策）
+const maxPixels = 40_000_000
+
+// 出力するサイズ（長辺）
+type Variant struct {
+	Name    string
+	MaxSide int
+}
+
+var (
+	Thumb  = Variant{Name: "thumb", MaxSide: 320}
+	Detail = Variant{Name: "detail", MaxSide: 1280}
+)
+
+// 中身を見て jpeg / png / gif だけ通す。拡張子や Content-Type は信用しない
+func Decode(data []byte) (image.Image, string, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", ErrUnsupportedFormat
+	}
+	if format != "jpeg" && format != "png" && format != "gif" {
+		return nil, "", ErrUnsupportedFormat
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > maxPixels {
+		return nil, "", ErrTooLarge
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", ErrUnsupportedFormat
+	}
+
+	// スマホ写真は EXIF の向き指定に従って回してから使う
+	if format == "jpeg" {
+		img = applyOrientation(img, jpegOrientation(data))
+	}
+	return img, format, nil
+}
+
+// 変換結果 1 つ分
+type Encoded struct {
+	Variant       Variant
+	Data          []byte
+	Width, Height int
+}
+
+// 各 Variant の長辺以下に縮めて JPEG にする（拡大はしない）。
+// 大きい方から順に作り、小さいものは 1 つ前の結果から縮める（元画像をなめるのは 1 回だけ）。
+// 画素から作り直すので EXIF（GPS 含む）などのメタデータは一切残らない
+func EncodeVariants(img image.Image, vs ...Variant) ([]Encoded, error) {
+	order := slices.Clone(vs)
+	slices.SortStableFunc(order, func(a, b Variant) int { return b.MaxSide - a.MaxSide })
+
+	out := make([]Encoded, 0, len(vs))
+	cur := img
+	for _, v := range order {
+		fitted := Fit(cur, v.MaxSide)
+		cur = fitted
+
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, fitted, &jpeg.Options{Quality: 85}); err != nil {
+			return nil, err
+		}
+		b := fitted.Bounds()
+		out = append(out, Encoded{Variant: v, Data: buf.Bytes(), Width: b.Dx(), Height: b.Dy()})
+	}
+	return out, nil
+}
+
+// 縦横比を保って長辺を maxSide 以下に。透過は白で塗る
+func Fit(src image.Image, maxSide int) *image.RGBA {
+	sb := src.Bounds()
+	sw, sh := sb.Dx(), sb.Dy()
+
+	dw, dh := sw, sh
+	if sw > maxSide || sh > maxSide {
+		if sw >= sh {
+			dw, dh = maxSide, max(1, sh*maxSide/sw)
+		} else {
+			dw, dh = max(1, sw*maxSide/sh), maxSide
+		}
+	}
+
+	// 一度 RGBA（白背景）に描いてから縮める。
+	// もう不透明な RGBA（向きを直した JPEG や前の Fit の結果）ならそのまま使い、原寸のコピーを作らない
+	full, ok := src.(*image.RGBA)
+	if !ok || sb.Min != (image.Point{}) || !full.Opaque() {
+		full = image.NewRGBA(image.Rect(0, 0, sw, sh))
+		draw.Draw(full, full.Bounds(), &image.Uniform{C: color.White}, image.Point{}, draw.Src)
+		draw.Draw(full, full.Bounds(), src, sb.Min, draw.Over)
+	}
+
+	if dw == sw && dh == sh {
+		return full
+	}
+	return boxResize(full, dw, dh)
+}
+
+// 面積平均で縮小（縮小専用。モアレが出にくい）
+func boxResize(src *image.RGBA, dw, dh int) *image.RGBA {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for dy := 0; dy < dh; dy++ {
+		y0 := dy * sh / dh
+		y1 := max(y0+1, (dy+1)*sh/dh)
+		for dx := 0; dx < dw; dx++ {
+			x0 := dx * sw / dw
+			x1 := max(x0+1, (dx+1)*sw/dw)
+
+			var r, g, b, a, n uint32
+			for y := y0; y < y1; y++ {
+				i := src.PixOffset(x0, y)
+				for x := x0; x < x1; x++ {
+					r += uint32(src.Pix[i])
+					g += uint32(src.Pix[i+1])
+					b += uint32(src.Pix[i+2])
+					a += uint32(src.Pix[i+3])
+					n++
+					i += 4
+				}
+			}
+
+			j := dst.PixOffset(dx, dy)
+			dst.Pix[j] = uint8(r / n)
+			dst.Pix[j+1] = uint8(g / n)
+			dst.Pix[j+2] = uint8(b / n)
+			dst.Pix[j+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
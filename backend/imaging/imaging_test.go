@@ -0,0 +1,196 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// 左半分が赤、右半分が青
+func twoTone(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.RGBA{R: 255, A: 255}
+			if x >= w/2 {
+				c = color.RGBA{B: 255, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+func encodeJPEG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// SOI の直後に Orientation だけ入った APP1(Exif) を差し込む
+func withOrientation(data []byte, bo binary.ByteOrder, o uint16) []byte {
+	tiff := make([]byte, 8+2+12+4)
+	if bo == binary.LittleEndian {
+		copy(tiff, "II")
+	} else {
+		copy(tiff, "MM")
+	}
+	bo.PutUint16(tiff[2:], 42)
+	bo.PutUint32(tiff[4:], 8)
+	bo.PutUint16(tiff[8:], 1)
+	bo.PutUint16(tiff[10:], 0x0112)
+	bo.PutUint16(tiff[12:], 3) // SHORT
+	bo.PutUint32(tiff[14:], 1)
+	bo.PutUint16(tiff[18:], o)
+
+	seg := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(app1[2:], uint16(len(seg)+2))
+	app1 = append(app1, seg...)
+
+	out := append([]byte{}, data[:2]...)
+	out = append(out, app1...)
+	return append(out, data[2:]...)
+}
+
+func isRed(c color.Color) bool {
+	r, g, b, _ := c.RGBA()
+	return r > 0xC000 && g < 0x4000 && b < 0x4000
+}
+
+func isBlue(c color.Color) bool {
+	r, g, b, _ := c.RGBA()
+	return b > 0xC000 && r < 0x4000 && g < 0x4000
+}
+
+func TestDecodeAppliesOrientation(t *testing.T) {
+	src := encodeJPEG(t, twoTone(64, 32))
+
+	tests := []struct {
+		name          string
+		data          []byte
+		w, h          int
+		first, second func(color.Color) bool // 左上寄りと右下寄りの色
+	}{
+		{"no exif", src, 64, 32, isRed, isBlue},
+		{"1 (as is)", withOrientation(src, binary.BigEndian, 1), 64, 32, isRed, isBlue},
+		{"3 (180)", withOrientation(src, binary.LittleEndian, 3), 64, 32, isBlue, isRed},
+		{"6 (cw 90)", withOrientation(src, binary.BigEndian, 6), 32, 64, isRed, isBlue},
+		{"8 (ccw 90)", withOrientation(src, binary.LittleEndian, 8), 32, 64, isBlue, isRed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, format, err := Decode(tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if format != "jpeg" {
+				t.Errorf("format = %q, want jpeg", format)
+			}
+			b := img.Bounds()
+			if b.Dx() != tt.w || b.Dy() != tt.h {
+				t.Fatalf("size = %dx%d, want %dx%d", b.Dx(), b.Dy(), tt.w, tt.h)
+			}
+			if c := img.At(b.Min.X+b.Dx()/4, b.Min.Y+b.Dy()/4); !tt.first(c) {
+				t.Errorf("top-left quarter = %v", c)
+			}
+			if c := img.At(b.Min.X+b.Dx()*3/4, b.Min.Y+b.Dy()*3/4); !tt.second(c) {
+				t.Errorf("bottom-right quarter = %v", c)
+			}
+		})
+	}
+}
+
+func TestDecodeRejects(t *testing.T) {
+	// 画素数だけ大きいと名乗る GIF（ヘッダの論理画面サイズを書き換える）
+	var buf bytes.Buffer
+	if err := gif.Encode(&buf, image.NewPaletted(image.Rect(0, 0, 1, 1), color.Palette{color.Black}), nil); err != nil {
+		t.Fatal(err)
+	}
+	huge := buf.Bytes()
+	binary.LittleEndian.PutUint16(huge[6:], 8000)
+	binary.LittleEndian.PutUint16(huge[8:], 8000)
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"too many pixels", huge, ErrTooLarge},
+		{"not an image", []byte("hello, world"), ErrUnsupportedFormat},
+		{"empty", nil, ErrUnsupportedFormat},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := Decode(tt.data); !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncodeVariantsSizes(t *testing.T) {
+	tests := []struct {
+		name             string
+		w, h             int
+		detailW, detailH int
+		thumbW, thumbH   int
+	}{
+		{"landscape", 2000, 1000, 1280, 640, 320, 160},
+		{"portrait", 900, 3000, 384, 1280, 96, 320},
+		{"between", 800, 600, 800, 600, 320, 240},
+		{"small is not enlarged", 100, 50, 100, 50, 100, 50},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 透過 PNG 経由にして、白で塗る経路も通す
+			var buf bytes.Buffer
+			if err := png.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, tt.w, tt.h))); err != nil {
+				t.Fatal(err)
+			}
+			img, _, err := Decode(buf.Bytes())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// 小さい方を先に渡しても大きい方から作る。結果は渡した順でなく作った順
+			got, err := EncodeVariants(img, Thumb, Detail)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != 2 || got[0].Variant != Detail || got[1].Variant != Thumb {
+				t.Fatalf("variants = %+v", got)
+			}
+
+			want := [][2]int{{tt.detailW, tt.detailH}, {tt.thumbW, tt.thumbH}}
+			for i, e := range got {
+				if e.Width != want[i][0] || e.Height != want[i][1] {
+					t.Errorf("%s = %dx%d, want %dx%d", e.Variant.Name, e.Width, e.Height, want[i][0], want[i][1])
+				}
+				cfg, format, err := image.DecodeConfig(bytes.NewReader(e.Data))
+				if err != nil || format != "jpeg" {
+					t.Fatalf("%s: format = %q, err = %v", e.Variant.Name, format, err)
+				}
+				if cfg.Width != e.Width || cfg.Height != e.Height {
+					t.Errorf("%s: encoded %dx%d, reported %dx%d", e.Variant.Name, cfg.Width, cfg.Height, e.Width, e.Height)
+				}
+				if c, _, err := image.Decode(bytes.NewReader(e.Data)); err == nil {
+					if r, g, b, _ := c.At(0, 0).RGBA(); r < 0xF000 || g < 0xF000 || b < 0xF000 {
+						t.Errorf("%s: transparent pixel = %v, want white", e.Variant.Name, c.At(0, 0))
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,219 @@
+// Package loginguard はログインの総当たり対策。
+// ユーザー ID とクライアント IP それぞれで失敗回数を数え、
+// 一定回数を超えたら指数的に待たせ、さらに続いたらしばらくロックする。
+package loginguard
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+var ErrLocked = errors.New("too many failed login attempts")
+
+type Config struct {
+	FreeAttempts int           // この回数までは待たせない
+	BaseDelay    time.Duration // 超えた 1 回目の待ち時間。以降 2 倍ずつ
+	MaxDelay     time.Duration
+
+	UserLockThreshold int // 同じユーザーへの連続失敗でロック
+	IPLockThreshold   int // 同じ IP からの失敗（ユーザー問わず）でロック
+	LockDuration      time.Duration
+
+	ResetAfter time.Duration // 最後の失敗からこれだけ経てば数え直す
+}
+
+var DefaultConfig = Config{
+	FreeAttempts:      3,
+	BaseDelay:         time.Second,
+	MaxDelay:          5 * time.Minute,
+	UserLockThreshold: 10,
+	IPLockThreshold:   50,
+	LockDuration:      15 * time.Minute,
+	ResetAfter:        time.Hour,
+}
+
+// 1 つのキー（ユーザー or IP）の状態
+// Failures には結果待ちの試行も含む（Allow で先に数え、成功したら戻す）
+type State struct {
+	Failures    int
+	LastFailure time.Time
+	LockedUntil time.Time
+}
+
+// 複数インスタンスで共有するときは Redis などで実装する
+type Store interface {
+	// key の今の状態（無ければ ok=false）を fn に渡し、返ってきた状態を expiresAt まで保存する。
+	// keep が false なら消す。読んでから書くまでの間に同じ key の Update を割り込ませないこと
+	// （並列のログイン試行が全部「まだ大丈夫」と判定されないように）
+	Update(key string, fn func(s State, ok bool) (next State, expiresAt time.Time, keep bool))
+	Delete(key string)
+}
+
+type Limiter struct {
+	store Store
+	cfg   Config
+	now   func() time.Time
+}
+
+// now は nil なら time.Now（テストで時計を差し替える用）
+func New(store Store, cfg Config, now func() time.Time) *Limiter {
+	if now == nil {
+		now = time.Now
+	}
+	return &Limiter{store: store, cfg: cfg, now: now}
+}
+
+func userKey(userID string) string { return "user:" + userID }
+func ipKey(ip string) string       { return "ip:" + ip }
+
+type limitKey struct {
+	key       string
+	threshold int
+}
+
+func (l *Limiter) keys(userID, ip string) []limitKey {
+	return []limitKey{
+		{userKey(userID), l.cfg.UserLockThreshold},
+		{ipKey(ip), l.cfg.IPLockThreshold},
+	}
+}
+
+// 試行してよいか。よければその試行を失敗として先に数えておく（並列に送られても枠を超えない）。
+// 結果が出たら Fail / Succeed / Release のどれかを呼ぶ。
+// ダメなら次に試せるまでの時間と ErrLocked を返す（何も数えない）
+func (l *Limiter) Allow(userID, ip string) (time.Duration, error) {
+	now := l.now()
+	keys := l.keys(userID, ip)
+
+	// ユーザー → IP の順に予約し、どこかで弾かれたらそれまでの予約を戻す
+	var wait time.Duration
+	reserved := 0
+	for _, k := range keys {
+		if wait = l.reserve(k.key, k.threshold, now); wait > 0 {
+			break
+		}
+		reserved++
+	}
+	if wait > 0 {
+		for _, k := range keys[:reserved] {
+			l.refund(k.key, k.threshold)
+		}
+		return wait, ErrLocked
+	}
+	return 0, nil
+}
+
+// 空いていれば 1 回分数えて 0、待つ必要があればその時間
+func (l *Limiter) reserve(key string, threshold int, now time.Time) time.Duration {
+	var wait time.Duration
+	l.store.Update(key, func(s State, ok bool) (State, time.Time, bool) {
+		s = l.current(s, ok, threshold, now)
+		if wait = l.retryAfter(s, now); wait > 0 {
+			return s, l.expiresAt(s), true
+		}
+
+		s.Failures++
+		s.LastFailure = now
+		if s.Failures == threshold {
+			s.LockedUntil = now.Add(l.cfg.LockDuration)
+		}
+		return s, l.expiresAt(s), true
+	})
+	return wait
+}
+
+// ResetAfter を過ぎた状態と、明けたロックは数え直す
+func (l *Limiter) current(s State, ok bool, threshold int, now time.Time) State {
+	if !ok {
+		return State{}
+	}
+	if now.Before(s.LockedUntil) {
+		return s
+	}
+	if now.Sub(s.LastFailure) >= l.cfg.ResetAfter || s.Failures >= threshold {
+		return State{}
+	}
+	return s
+}
+
+func (l *Limiter) retryAfter(s State, now time.Time) time.Duration {
+	if now.Before(s.LockedUntil) {
+		return s.LockedUntil.Sub(now)
+	}
+	if next := s.LastFailure.Add(l.delay(s.Failures)); now.Before(next) {
+		return next.Sub(now)
+	}
+	return 0
+}
+
+// 失敗回数 n のあとに空けるべき時間
+func (l *Limiter) delay(n int) time.Duration {
+	over := n - l.cfg.FreeAttempts
+	if over <= 0 {
+		return 0
+	}
+	d := float64(l.cfg.BaseDelay) * math.Pow(2, float64(over-1))
+	if d > float64(l.cfg.MaxDelay) {
+		return l.cfg.MaxDelay
+	}
+	return time.Duration(d)
+}
+
+func (l *Limiter) expiresAt(s State) time.Time {
+	exp := s.LastFailure.Add(l.cfg.ResetAfter)
+	if s.LockedUntil.After(exp) {
+		exp = s.LockedUntil
+	}
+	return exp
+}
+
+// 予約した 1 回分を戻す。その試行でかかったロックも外す
+func (l *Limiter) refund(key string, threshold int) {
+	l.store.Update(key, func(s State, ok bool) (State, time.Time, bool) {
+		if !ok {
+			return s, time.Time{}, false
+		}
+		if s.Failures > 0 {
+			s.Failures--
+		}
+		if s.Failures < threshold {
+			s.LockedUntil = time.Time{}
+		}
+		return s, l.expiresAt(s), true
+	})
+}
+
+// Allow で予約した試行が失敗だった。数はもう入っているので、ロック中かどうかだけ返す
+func (l *Limiter) Fail(userID, ip string) bool {
+	now := l.now()
+	locked := false
+	for _, k := range l.keys(userID, ip) {
+		l.store.Update(k.key, func(s State, ok bool) (State, time.Time, bool) {
+			if ok && now.Before(s.LockedUntil) {
+				locked = true
+			}
+			return s, l.expiresAt(s), ok
+		})
+	}
+	return locked
+}
+
+// 失敗でも成功でもなかった試行（パスワードは合っていて 2 段階認証に進む など）の予約を戻す
+func (l *Limiter) Release(userID, ip string) {
+	for _, k := range l.keys(userID, ip) {
+		l.refund(k.key, k.threshold)
+	}
+}
+
+// 成功したらそのユーザーの失敗は忘れる
+// IP 側は予約分を戻すだけで消さない（自分のアカウントでログインして数をリセットされないように）
+func (l *Limiter) Succeed(userID, ip string) {
+	l.store.Delete(userKey(userID))
+	l.refund(ipKey(ip), l.cfg.IPLockThreshold)
+}
+
+// 試行とは関係なくユーザーのロックを解く（パスワード再設定のあとなど）
+func (l *Limiter) Unlock(userID string) {
+	l.store.Delete(userKey(userID))
+}
@@ -0,0 +1,253 @@
+package loginguard
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testConfig = Config{
+	FreeAttempts:      3,
+	BaseDelay:         time.Second,
+	MaxDelay:          5 * time.Second,
+	UserLockThreshold: 8,
+	IPLockThreshold:   20,
+	LockDuration:      15 * time.Minute,
+	ResetAfter:        time.Hour,
+}
+
+type fakeClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = c.t.Add(d)
+}
+
+func newTestLimiter() (*Limiter, *MemoryStore, *fakeClock) {
+	clock := &fakeClock{t: time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)}
+	store := NewMemoryStore(clock.Now)
+	return New(store, testConfig, clock.Now), store, clock
+}
+
+// 待たされたら時計を進めてから試し、失敗させる。Fail の戻り値（ロックされたか）を返す
+func failOnce(t *testing.T, l *Limiter, clock *fakeClock, userID, ip string) bool {
+	t.Helper()
+	if wait, err := l.Allow(userID, ip); err != nil {
+		clock.Advance(wait)
+		if _, err := l.Allow(userID, ip); err != nil {
+			t.Fatalf("Allow after waiting %v: %v", wait, err)
+		}
+	}
+	return l.Fail(userID, ip)
+}
+
+func failuresOf(s *MemoryStore, key string) int {
+	n := 0
+	s.Update(key, func(st State, ok bool) (State, time.Time, bool) {
+		n = st.Failures
+		return st, s.entries[key].expiresAt, ok
+	})
+	return n
+}
+
+func TestBackoffGrowth(t *testing.T) {
+	tests := []struct {
+		failures int
+		wantWait time.Duration
+	}{
+		{1, 0},
+		{3, 0},
+		{4, time.Second},
+		{5, 2 * time.Second},
+		{6, 4 * time.Second},
+		{7, 5 * time.Second}, // MaxDelay で頭打ち
+	}
+	for _, tt := range tests {
+		l, _, clock := newTestLimiter()
+		for i := 0; i < tt.failures; i++ {
+			failOnce(t, l, clock, "alice", "10.0.0.1")
+		}
+
+		wait, err := l.Allow("alice", "10.0.0.1")
+		if tt.wantWait == 0 {
+			if err != nil {
+				t.Errorf("after %d failures: Allow = %v, %v; want allowed", tt.failures, wait, err)
+			}
+			continue
+		}
+		if !errors.Is(err, ErrLocked) || wait != tt.wantWait {
+			t.Errorf("after %d failures: Allow = %v, %v; want %v, ErrLocked", tt.failures, wait, err, tt.wantWait)
+		}
+	}
+}
+
+func TestLockAtThreshold(t *testing.T) {
+	l, _, clock := newTestLimiter()
+
+	for i := 1; i <= testConfig.UserLockThreshold; i++ {
+		locked := failOnce(t, l, clock, "alice", "10.0.0.1")
+		if want := i == testConfig.UserLockThreshold; locked != want {
+			t.Fatalf("failure %d: locked = %v, want %v", i, locked, want)
+		}
+	}
+
+	wait, err := l.Allow("alice", "10.0.0.2")
+	if !errors.Is(err, ErrLocked) || wait != testConfig.LockDuration {
+		t.Fatalf("Allow while locked = %v, %v; want %v, ErrLocked", wait, err, testConfig.LockDuration)
+	}
+}
+
+func TestUnlockAfterLockDuration(t *testing.T) {
+	tests := []struct {
+		name     string
+		elapsed  time.Duration
+		wantWait time.Duration
+	}{
+		{"just locked", 0, testConfig.LockDuration},
+		{"one second left", testConfig.LockDuration - time.Second, time.Second},
+		{"lock expired", testConfig.LockDuration, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, _, clock := newTestLimiter()
+			for i := 0; i < testConfig.UserLockThreshold; i++ {
+				failOnce(t, l, clock, "alice", "10.0.0.1")
+			}
+
+			clock.Advance(tt.elapsed)
+			wait, err := l.Allow("alice", "10.0.0.1")
+			if wait != tt.wantWait || (err != nil) != (tt.wantWait > 0) {
+				t.Fatalf("Allow = %v, %v; want wait %v", wait, err, tt.wantWait)
+			}
+			if tt.wantWait > 0 {
+				return
+			}
+
+			// ロック明けは数え直し。FreeAttempts までは待たされない
+			// （IP 側の待ちは続いているので別の IP から）
+			l.Fail("alice", "10.0.0.1")
+			for i := 1; i < testConfig.FreeAttempts; i++ {
+				if wait, err := l.Allow("alice", "10.0.0.2"); err != nil {
+					t.Fatalf("attempt %d after unlock: Allow = %v, %v", i+1, wait, err)
+				}
+				l.Fail("alice", "10.0.0.2")
+			}
+		})
+	}
+}
+
+func TestResetAfter(t *testing.T) {
+	tests := []struct {
+		name    string
+		elapsed time.Duration
+		allowed bool
+	}{
+		{"before reset", testConfig.ResetAfter - time.Minute, false},
+		{"after reset", testConfig.ResetAfter, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, store, clock := newTestLimiter()
+			for i := 0; i < testConfig.UserLockThreshold-1; i++ {
+				failOnce(t, l, clock, "alice", "10.0.0.1")
+			}
+
+			clock.Advance(tt.elapsed)
+			if tt.allowed {
+				if _, err := l.Allow("alice", "10.0.0.1"); err != nil {
+					t.Fatalf("Allow after ResetAfter: %v", err)
+				}
+				if n := failuresOf(store, userKey("alice")); n != 1 {
+					t.Fatalf("failures after reset = %d, want 1", n)
+				}
+				return
+			}
+
+			// あと 1 回でロック。リセット前なので数が残っている
+			if locked := failOnce(t, l, clock, "alice", "10.0.0.1"); !locked {
+				t.Fatal("expected lock before ResetAfter")
+			}
+		})
+	}
+}
+
+func TestSucceedClearsUserButNotIP(t *testing.T) {
+	l, store, clock := newTestLimiter()
+	for i := 0; i < 5; i++ {
+		failOnce(t, l, clock, "alice", "10.0.0.1")
+	}
+	clock.Advance(time.Minute)
+
+	if _, err := l.Allow("alice", "10.0.0.1"); err != nil {
+		t.Fatalf("Allow: %v", err)
+	}
+	l.Succeed("alice", "10.0.0.1")
+
+	if n := failuresOf(store, userKey("alice")); n != 0 {
+		t.Errorf("user failures after Succeed = %d, want 0", n)
+	}
+	// 成功した試行の分だけ戻り、それまでの失敗は残る
+	if n := failuresOf(store, ipKey("10.0.0.1")); n != 5 {
+		t.Errorf("ip failures after Succeed = %d, want 5", n)
+	}
+}
+
+func TestReleaseDoesNotCountAttempt(t *testing.T) {
+	l, store, _ := newTestLimiter()
+
+	for i := 0; i < 10; i++ {
+		if _, err := l.Allow("alice", "10.0.0.1"); err != nil {
+			t.Fatalf("attempt %d: %v", i+1, err)
+		}
+		l.Release("alice", "10.0.0.1")
+	}
+	if n := failuresOf(store, userKey("alice")); n != 0 {
+		t.Errorf("user failures = %d, want 0", n)
+	}
+	if n := failuresOf(store, ipKey("10.0.0.1")); n != 0 {
+		t.Errorf("ip failures = %d, want 0", n)
+	}
+}
+
+// 結果が返る前に並列で送っても、順番に送ったときと同じ回数しか通らない
+func TestParallelAttemptsShareLimit(t *testing.T) {
+	l, store, _ := newTestLimiter()
+
+	const n = 50
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		allowed int
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := l.Allow("alice", "10.0.0.1"); err == nil {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// FreeAttempts 回失敗したあとも 1 回は待たずに試せる
+	if want := testConfig.FreeAttempts + 1; allowed != want {
+		t.Fatalf("allowed = %d, want %d", allowed, want)
+	}
+	if n := failuresOf(store, ipKey("10.0.0.1")); n != allowed {
+		t.Fatalf("ip failures = %d, want %d (rejected attempts must not be counted)", n, allowed)
+	}
+}
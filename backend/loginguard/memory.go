@@ -0,0 +1,64 @@
+package loginguard
+
+import (
+	"sync"
+	"time"
+)
+
+// プロセス内だけの Store。インスタンスごとに別々に数える
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+	now     func() time.Time
+}
+
+type memoryEntry struct {
+	state     State
+	expiresAt time.Time
+}
+
+// now は nil なら time.Now
+func NewMemoryStore(now func() time.Time) *MemoryStore {
+	if now == nil {
+		now = time.Now
+	}
+	return &MemoryStore{entries: map[string]memoryEntry{}, now: now}
+}
+
+func (m *MemoryStore) Update(key string, fn func(s State, ok bool) (State, time.Time, bool)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.entries[key]
+	if ok && !m.now().Before(e.expiresAt) {
+		e, ok = memoryEntry{}, false
+	}
+	next, expiresAt, keep := fn(e.state, ok)
+	if !keep {
+		delete(m.entries, key)
+		return
+	}
+	m.entries[key] = memoryEntry{state: next, expiresAt: expiresAt}
+}
+
+func (m *MemoryStore) Delete(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, key)
+}
+
+// 期限切れを掃除する（goroutine で定期的に呼ぶ）
+func (m *MemoryStore) Sweep() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	n := 0
+	for k, e := range m.entries {
+		if !now.Before(e.expiresAt) {
+			delete(m.entries, k)
+			n++
+		}
+	}
+	return n
+}
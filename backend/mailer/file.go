@@ -0,0 +1,51 @@
+package mailer
+
+import (
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"freemarket-backend/ids"
+)
+
+var ErrInvalidHeader = errors.New("invalid mail header")
+
+// ログに出すだけの Mailer（開発用）
+type Log struct {
+	from string
+}
+
+func NewLog(from string) *Log {
+	return &Log{from: from}
+}
+
+func (l *Log) Send(m Message) error {
+	if !validHeader(m.To) || !validHeader(m.Subject) {
+		return ErrInvalidHeader
+	}
+	log.Printf("📧 mail to=%s subject=%q\n%s", m.To, m.Subject, m.Body)
+	return nil
+}
+
+// dir に .eml を書き出す Mailer（開発用。メールクライアントでそのまま開ける）
+type File struct {
+	dir  string
+	from string
+}
+
+func NewFile(dir, from string) (*File, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &File{dir: dir, from: from}, nil
+}
+
+func (f *File) Send(m Message) error {
+	if !validHeader(m.To) || !validHeader(m.Subject) {
+		return ErrInvalidHeader
+	}
+	name := time.Now().Format("20060102-150405") + "-" + ids.New("mail") + ".eml"
+	return os.WriteFile(filepath.Join(f.dir, name), m.render(f.from), 0o600)
+}
@@ -0,0 +1,58 @@
+package mailer
+
+import (
+	"errors"
+	"os"
+	"strconv"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string // text/plain
+}
+
+// メール送信。パスワード再設定のリンクなどを送る
+type Mailer interface {
+	Send(m Message) error
+}
+
+// MAILER=log（既定）| file | smtp
+//
+//	log:  本文ごとログに出す（開発用。本番では使わない）
+//	file: MAIL_DIR（既定 ./mail）に 1 通 1 ファイルの .eml で書き出す
+//	smtp: SMTP_HOST, SMTP_PORT（既定 587）, SMTP_USERNAME, SMTP_PASSWORD, MAIL_FROM
+//	      ローカルでは MailHog / smtp4dev（localhost:1025）に向ければ同じコードで動く
+func NewFromEnv() (Mailer, error) {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "no-reply@freemarket.local"
+	}
+
+	switch os.Getenv("MAILER") {
+	case "", "log":
+		return NewLog(from), nil
+	case "file":
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" {
+			dir = "./mail"
+		}
+		return NewFile(dir, from)
+	case "smtp":
+		host := os.Getenv("SMTP_HOST")
+		if host == "" {
+			return nil, errors.New("SMTP_HOST is required")
+		}
+		port := 587
+		if v := os.Getenv("SMTP_PORT"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, errors.New("invalid SMTP_PORT")
+			}
+			port = n
+		}
+		return NewSMTP(host, port, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), from), nil
+	default:
+		return nil, errors.New("unknown MAILER")
+	}
+}
@@ -0,0 +1,36 @@
+package mailer
+
+import (
+	"net"
+	"net/smtp"
+	"strconv"
+)
+
+// SMTP で送る Mailer。サーバーが対応していれば STARTTLS に上がる
+// username が空なら認証しない（MailHog などのローカル SMTP 用）
+type SMTP struct {
+	addr string
+	host string
+	auth smtp.Auth
+	from string
+}
+
+func NewSMTP(host string, port int, username, password, from string) *SMTP {
+	s := &SMTP{
+		addr: net.JoinHostPort(host, strconv.Itoa(port)),
+		host: host,
+		from: from,
+	}
+	if username != "" {
+		// PlainAuth は TLS か localhost でないと送らない
+		s.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return s
+}
+
+func (s *SMTP) Send(m Message) error {
+	if !validHeader(m.To) || !validHeader(m.Subject) {
+		return ErrInvalidHeader
+	}
+	return smtp.SendMail(s.addr, s.auth, s.from, []string{m.To}, m.render(s.from))
+}
@@ -0,0 +1,162 @@
+package mailer
+
+import (
+	"bufio"
+	"mime"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 最低限の SMTP サーバー（STARTTLS・認証なし）。受け取った 1 通を返す
+type received struct {
+	from string
+	rcpt []string
+	data string
+}
+
+func startSMTPServer(t *testing.T) (host string, port int, got <-chan received) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	ch := make(chan received, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+		tp := textproto.NewConn(conn)
+		var msg received
+		tp.PrintfLine("220 localhost test SMTP")
+		for {
+			line, err := tp.ReadLine()
+			if err != nil {
+				return
+			}
+			cmd := strings.ToUpper(line)
+			switch {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				tp.PrintfLine("250 localhost")
+			case strings.HasPrefix(cmd, "MAIL FROM:"):
+				msg.from = strings.Trim(line[len("MAIL FROM:"):], "<>")
+				tp.PrintfLine("250 OK")
+			case strings.HasPrefix(cmd, "RCPT TO:"):
+				msg.rcpt = append(msg.rcpt, strings.Trim(line[len("RCPT TO:"):], "<>"))
+				tp.PrintfLine("250 OK")
+			case cmd == "DATA":
+				tp.PrintfLine("354 end with <CRLF>.<CRLF>")
+				b, err := tp.ReadDotBytes()
+				if err != nil {
+					return
+				}
+				msg.data = string(b)
+				tp.PrintfLine("250 OK")
+			case cmd == "QUIT":
+				tp.PrintfLine("221 bye")
+				ch <- msg
+				return
+			default:
+				tp.PrintfLine("502 not implemented")
+			}
+		}
+	}()
+
+	addr := ln.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port, ch
+}
+
+func TestSMTPSend(t *testing.T) {
+	host, port, got := startSMTPServer(t)
+	s := NewSMTP(host, port, "", "", "no-reply@freemarket.test")
+
+	err := s.Send(Message{
+		To:      "alice@example.com",
+		Subject: "パスワード再設定",
+		Body:    "こんにちは\nhttps://example.com/?token=abc\n",
+	})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	var msg received
+	select {
+	case msg = <-got:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received")
+	}
+
+	if msg.from != "no-reply@freemarket.test" {
+		t.Errorf("MAIL FROM = %q", msg.from)
+	}
+	if len(msg.rcpt) != 1 || msg.rcpt[0] != "alice@example.com" {
+		t.Errorf("RCPT TO = %q", msg.rcpt)
+	}
+
+	tp := textproto.NewReader(bufio.NewReader(strings.NewReader(msg.data)))
+	hdr, err := tp.ReadMIMEHeader()
+	if err != nil {
+		t.Fatalf("read headers: %v", err)
+	}
+	for k, want := range map[string]string{
+		"From":         "no-reply@freemarket.test",
+		"To":           "alice@example.com",
+		"Content-Type": "text/plain; charset=utf-8",
+	} {
+		if got := hdr.Get(k); got != want {
+			t.Errorf("%s = %q, want %q", k, got, want)
+		}
+	}
+	if subject, err := new(mime.WordDecoder).DecodeHeader(hdr.Get("Subject")); err != nil || subject != "パスワード再設定" {
+		t.Errorf("Subject = %q (decoded %q, %v)", hdr.Get("Subject"), subject, err)
+	}
+	if hdr.Get("Date") == "" {
+		t.Error("Date header missing")
+	}
+
+	// ReadDotBytes が CRLF を LF に戻している
+	body := strings.SplitN(msg.data, "\n\n", 2)
+	if len(body) != 2 || body[1] != "こんにちは\nhttps://example.com/?token=abc\n" {
+		t.Errorf("body = %q", msg.data)
+	}
+}
+
+func TestValidHeader(t *testing.T) {
+	tests := []struct {
+		in   string
+		want bool
+	}{
+		{"alice@example.com", true},
+		{"パスワード再設定", true},
+		{"alice@example.com\r\nBcc: mallory@example.com", false},
+		{"hello\nBcc: mallory@example.com", false},
+		{"hello\rworld", false},
+	}
+	for _, tt := range tests {
+		if got := validHeader(tt.in); got != tt.want {
+			t.Errorf("validHeader(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSMTPSendRejectsHeaderInjection(t *testing.T) {
+	// 送る前に弾くので、つながらない宛先でよい
+	s := NewSMTP("127.0.0.1", 1, "", "", "no-reply@freemarket.test")
+	for _, m := range []Message{
+		{To: "alice@example.com\r\nBcc: mallory@example.com", Subject: "hi"},
+		{To: "alice@example.com", Subject: "hi\nBcc: mallory@example.com"},
+	} {
+		if err := s.Send(m); err != ErrInvalidHeader {
+			t.Errorf("Send(%q, %q) = %v, want ErrInvalidHeader", m.To, m.Subject, err)
+		}
+	}
+}
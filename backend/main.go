@@ -1,18 +1,37 @@
 package main
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"freemarket-backend/auth"
 	"freemarket-backend/db"
 	"freemarket-backend/domain"
+	"freemarket-backend/escrow"
+	"freemarket-backend/ids"
+	"freemarket-backend/imaging"
+	"freemarket-backend/loginguard"
+	"freemarket-backend/mailer"
 	"freemarket-backend/middleware"
+	"freemarket-backend/payment"
+	"freemarket-backend/pubsub"
 	"freemarket-backend/repository"
+	"freemarket-backend/storage"
+	"io"
 	"log"
+	"math"
+	"net"
 	"net/http"
+	netmail "net/mail"
+	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/joho/godotenv" // ← ★追加
 	"golang.org/x/crypto/bcrypt"
@@ -47,8 +66,9 @@ func withCORS(h http.HandlerFunc) http.HandlerFunc {
 			w.Header().Set("Vary", "Origin")
 		}
 
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, If-None-Match")
+		w.Header().Set("Access-Control-Expose-Headers", "X-Next-Cursor, X-Has-More, ETag, Retry-After")
 
 		// preflight はここで終わらせる（RequireAuthまで行かせない）
 		if r.Method == http.MethodOptions {
@@ -60,6 +80,35 @@ func withCORS(h http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// ===== クライアント IP =====
+// X-Forwarded-For は誰でも付けられるので、前にプロキシがいると設定されたときだけ読む
+// （TRUST_PROXY_HEADERS=true か Cloud Run 上）。それ以外は接続元そのもの。
+// プロキシは末尾に接続元を足す。先頭側はクライアントが自由に書けるので、信用するのは末尾だけ
+func clientIP(r *http.Request) string {
+	if trustProxyHeaders() {
+		if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+			parts := strings.Split(xff, ",")
+			if ip := strings.TrimSpace(parts[len(parts)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// TRUST_PROXY_HEADERS があればそれに従う。無ければ Cloud Run 上でだけ信用する
+func trustProxyHeaders() bool {
+	if v := os.Getenv("TRUST_PROXY_HEADERS"); v != "" {
+		ok, _ := strconv.ParseBool(v)
+		return ok
+	}
+	return os.Getenv("K_SERVICE") != ""
+}
+
 // ===== 任意トークンから userId を取り出す（/products GET 用）=====
 // 認証必須ではなく「付いてたら読む」だけ
 func tryGetUserID(r *http.Request) (string, bool) {
@@ -72,13 +121,330 @@ func tryGetUserID(r *http.Request) (string, bool) {
 		return "", false
 	}
 
-	claims, err := auth.VerifyToken(strings.TrimPrefix(h, prefix))
+	claims, err := middleware.Authenticate(strings.TrimPrefix(h, prefix))
 	if err != nil {
 		return "", false
 	}
 	return claims.UserID, true
 }
 
+// 2 段階認証のコード違い（TOTP / リカバリーコードどちらも）
+var errSecondFactor = errors.New("invalid second factor")
+
+// ログイン / リフレッシュの返却値。token はアクセストークン（フロント互換でこの名前のまま）
+type tokenResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+	ExpiresIn    int    `json:"expiresIn"` // token の残り秒数
+}
+
+func newTokenResponse(userID, sessionID, refreshToken string) (tokenResponse, error) {
+	token, err := auth.IssueToken(userID, sessionID)
+	if err != nil {
+		return tokenResponse{}, err
+	}
+	return tokenResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(auth.AccessTokenTTL() / time.Second),
+	}, nil
+}
+
+// ===== GET /products の検索条件 =====
+// ?q=&minPrice=&maxPrice=&status=&sellerId=&sort=&cursor=&limit=
+func parseProductQuery(r *http.Request) (repository.ProductQuery, error) {
+	v := r.URL.Query()
+	q := repository.ProductQuery{
+		Keyword:  strings.TrimSpace(v.Get("q")),
+		Status:   v.Get("status"),
+		SellerID: v.Get("sellerId"),
+		Sort:     v.Get("sort"),
+		Cursor:   v.Get("cursor"),
+	}
+
+	intParam := func(name string) (*int, error) {
+		s := v.Get(name)
+		if s == "" {
+			return nil, nil
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid %s", name)
+		}
+		return &n, nil
+	}
+
+	var err error
+	if q.MinPrice, err = intParam("minPrice"); err != nil {
+		return q, err
+	}
+	if q.MaxPrice, err = intParam("maxPrice"); err != nil {
+		return q, err
+	}
+	limit, err := intParam("limit")
+	if err != nil {
+		return q, err
+	}
+	if limit != nil {
+		q.Limit = *limit
+	}
+
+	if q.Status != "" && q.Status != "available" && q.Status != "sold" && q.Status != "considering" {
+		return q, fmt.Errorf("invalid status")
+	}
+	switch q.Sort {
+	case "", repository.SortNewest, repository.SortPriceAsc, repository.SortPriceDesc, repository.SortMostLiked:
+	default:
+		return q, fmt.Errorf("invalid sort")
+	}
+
+	return q, nil
+}
+
+// ===== チャットの配信先 =====
+// 商品 + 2人の組で 1 スレッド。どちらから見ても同じ topic になるよう並べる
+func chatTopic(productID, userA, userB string) string {
+	if userA > userB {
+		userA, userB = userB, userA
+	}
+	return "chat:" + productID + ":" + userA + ":" + userB
+}
+
+// ===== 値下げ交渉 =====
+
+const (
+	defaultOfferExpiryHours      = 48 // 返答期限（OFFER_EXPIRY_HOURS）
+	defaultOfferReservationHours = 24 // 承諾後の取り置き（OFFER_RESERVATION_HOURS）
+)
+
+func hoursFromEnv(key string, def int) time.Duration {
+	hours := def
+	if v := os.Getenv(key); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			log.Println("⚠️ invalid "+key+", using default:", v)
+		} else {
+			hours = n
+		}
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// 注文の取り消しで決済を返金する。与信前・与信NG・返金済みなら返すお金は無い
+func refundPayment(p payment.Provider, intentID string) error {
+	if intentID == "" {
+		return nil
+	}
+	in, err := p.Refund(intentID)
+	if err == payment.ErrInvalidState && in.Status != payment.StatusAuthorized && in.Status != payment.StatusCaptured {
+		return nil
+	}
+	return err
+}
+
+// チャットのストリームに流すオファーのイベント
+type offerEvent struct {
+	Action string       `json:"action"` // "offered" | "countered" | "accepted" | "rejected"
+	By     string       `json:"by"`
+	Offer  domain.Offer `json:"offer"`
+}
+
+// チャットに残すオファーのメッセージ本文
+func offerMessageBody(action string, price int) string {
+	switch action {
+	case "offered":
+		return fmt.Sprintf("¥%d でオファーしました", price)
+	case "countered":
+		return fmt.Sprintf("¥%d で金額を提案しました", price)
+	case "accepted":
+		return fmt.Sprintf("¥%d のオファーを承諾しました", price)
+	case "rejected":
+		return "オファーを断りました"
+	}
+	return "オファーが更新されました"
+}
+
+// ===== チャット添付 =====
+
+const (
+	maxAttachmentSize        = 5 << 20 // 5MB
+	maxAttachmentsPerMessage = 4
+)
+
+// 受け付ける画像の種類 → 保存時の拡張子
+var attachmentTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// ===== 出品画像 =====
+
+const maxUploadSize = 10 << 20 // 10MB
+
+// PUBLIC_BASE_URL（例: https://api.example.com）を付けてフロントからそのまま使える URL にする
+func imageURL(id, variant string) string {
+	return os.Getenv("PUBLIC_BASE_URL") + "/uploads/" + id + "/" + variant
+}
+
+func imageKey(id, variant string) string {
+	return "images/" + id + "/" + variant + ".jpg"
+}
+
+// 画像は DB に id だけ持ち、URL は返すときに組み立てる（PUBLIC_BASE_URL を変えても壊れない）
+// image_id の無い古い商品は image_url（外部 URL）をそのまま使う
+func coverImageURL(imageID, legacyURL string) string {
+	if imageID != "" {
+		return imageURL(imageID, imaging.Detail.Name)
+	}
+	return legacyURL
+}
+
+// 出品時の画像は POST /uploads で上げた imageId で指定する（任意の URL は受け付けない）
+const rawImageURLError = "not accepted; upload via POST /uploads and send imageId"
+
+func withImageURLs(img domain.Image) domain.Image {
+	img.ThumbURL = imageURL(img.ID, imaging.Thumb.Name)
+	img.DetailURL = imageURL(img.ID, imaging.Detail.Name)
+	return img
+}
+
+// If-None-Match（カンマ区切り / "*" / W/ 付き）に etag が含まれるか
+func etagMatches(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimPrefix(strings.TrimSpace(t), "W/")
+		if t == "*" || t == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// ===== 出品内容のバリデーション =====
+
+const (
+	maxTitleLen       = 100
+	maxDescriptionLen = 2000
+	maxPrice          = 9_999_999
+)
+
+// ===== パスワード =====
+
+const (
+	minPasswordLen   = 8
+	maxPasswordBytes = 72 // bcrypt はこれより後ろを無視する
+
+	maxUserIDLen = 64  // ID 列は VARCHAR(64)
+	maxEmailLen  = 254 // RFC 5321 の上限。users.email も VARCHAR(254)
+
+	passwordResetTTL      = 30 * time.Minute
+	passwordResetCooldown = time.Minute // 同じユーザーへの再送間隔
+)
+
+// 問題なければ空
+func validatePassword(pw string) string {
+	if utf8.RuneCountInString(pw) < minPasswordLen {
+		return fmt.Sprintf("must be at least %d characters", minPasswordLen)
+	}
+	if len(pw) > maxPasswordBytes {
+		return fmt.Sprintf("must be at most %d bytes", maxPasswordBytes)
+	}
+	return ""
+}
+
+// 空文字はそのまま（未設定）。形式がおかしければメッセージを返す
+func normalizeEmail(s string) (string, string) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", ""
+	}
+	if len(s) > maxEmailLen {
+		return "", fmt.Sprintf("must be at most %d characters", maxEmailLen)
+	}
+	a, err := netmail.ParseAddress(s)
+	if err != nil || a.Address != s {
+		return "", "must be a valid email address"
+	}
+	return strings.ToLower(s), ""
+}
+
+// 再設定メールのリンク先（フロントのトップ。?token= が付いていると再設定画面を開く）
+// Cloud Run 上では PASSWORD_RESET_URL 必須（localhost に飛ばしても開けない）
+func passwordResetURL() (string, error) {
+	if v := os.Getenv("PASSWORD_RESET_URL"); v != "" {
+		return v, nil
+	}
+	if os.Getenv("K_SERVICE") != "" {
+		return "", errors.New("PASSWORD_RESET_URL is not set")
+	}
+	return "http://localhost:5173/", nil
+}
+
+// 評価コメントの上限
+const maxReviewCommentLen = 1000
+
+// 見積もりリクエストに添える一言の上限
+const maxQuoteMessageLen = 500
+
+// 項目名 → エラー内容。問題なければ空
+func validateProduct(p domain.Product) map[string]string {
+	errs := map[string]string{}
+
+	title := strings.TrimSpace(p.Title)
+	if title == "" {
+		errs["title"] = "required"
+	} else if utf8.RuneCountInString(title) > maxTitleLen {
+		errs["title"] = fmt.Sprintf("must be at most %d characters", maxTitleLen)
+	}
+
+	if utf8.RuneCountInString(p.Description) > maxDescriptionLen {
+		errs["description"] = fmt.Sprintf("must be at most %d characters", maxDescriptionLen)
+	}
+
+	// status バリデーション（3択）
+	if p.Status != "available" && p.Status != "sold" && p.Status != "considering" {
+		errs["status"] = "must be one of available, sold, considering"
+	}
+
+	// considering は価格未定なので 0 のみ
+	if p.Status != "considering" && (p.Price < 1 || p.Price > maxPrice) {
+		errs["price"] = fmt.Sprintf("must be between 1 and %d", maxPrice)
+	}
+
+	return errs
+}
+
+// 400 で { "errors": { "title": "required", ... } } を返す
+func writeFieldErrors(w http.ResponseWriter, errs map[string]string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]any{"errors": errs})
+}
+
+// パスワード変更・メール変更の「今のパスワード」確認。
+// 盗まれたアクセストークンで総当たりされないよう、ログインと同じ枠（ユーザー + IP）で数える。
+// 通れば true。だめなら 429 か 400 を書いて false
+func checkCurrentPassword(w http.ResponseWriter, r *http.Request, limiter *loginguard.Limiter, recordFailure func(userID, ip, reason string), u domain.User, password string) bool {
+	ip := clientIP(r)
+	if wait, err := limiter.Allow(u.ID, ip); err != nil {
+		recordFailure(u.ID, ip, repository.LoginFailThrottled)
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return false
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)); err != nil {
+		recordFailure(u.ID, ip, repository.LoginFailBadPassword)
+		writeFieldErrors(w, map[string]string{"currentPassword": "incorrect"})
+		return false
+	}
+	limiter.Succeed(u.ID, ip)
+	return true
+}
+
 // ===== App =====
 
 func main() {
@@ -88,6 +454,10 @@ func main() {
 		log.Println("⚠️ .env not found (using OS env vars)")
 	}
 
+	if err := auth.LoadKeyring(); err != nil {
+		log.Fatal("JWT keyring:", err)
+	}
+
 	database, err := db.NewDB()
 	if err != nil {
 		log.Fatal("DB connection failed:", err) // ★ returnじゃなく死ぬ
@@ -95,13 +465,249 @@ func main() {
 
 	store := repository.NewSQLiteProductRepository(database)
 	userRepo := repository.NewUserRepository(database)
+	sessionRepo := repository.NewSessionRepository(database)
+	resetRepo := repository.NewPasswordResetRepository(database)
+	resetURL, err := passwordResetURL()
+	if err != nil {
+		log.Fatal("password reset:", err)
+	}
+	// ログアウト済みのアクセストークンは期限内でも弾く
+	middleware.SessionActive = sessionRepo.IsActive
 	msgRepo := repository.NewSQLiteMessageRepository(database)
+	orderRepo := repository.NewOrderRepository(database)
+	ledgerRepo := repository.NewLedgerRepository(database)
+
+	attachRepo := repository.NewAttachmentRepository(database)
+	imageRepo := repository.NewImageRepository(database)
+
+	// アップロードファイルの置き場所（STORAGE_BACKEND=local | s3）
+	blobs, err := storage.NewFromEnv()
+	if err != nil {
+		log.Fatal("storage init failed:", err)
+	}
+
+	productImageRepo := repository.NewProductImageRepository(database)
+	reviewRepo := repository.NewReviewRepository(database)
+	offerRepo := repository.NewOfferRepository(database)
+	quoteRepo := repository.NewQuoteRequestRepository(database)
+	offerExpiry := hoursFromEnv("OFFER_EXPIRY_HOURS", defaultOfferExpiryHours)
+	offerReservation := hoursFromEnv("OFFER_RESERVATION_HOURS", defaultOfferReservationHours)
+
+	// 他人に見せるプロフィール（評価の平均と件数つき）
+	publicProfile := func(u domain.User) domain.PublicProfile {
+		pp := domain.PublicProfile{UserID: u.ID, DisplayName: u.DisplayName, MBTI: u.MBTI}
+		rating, count, err := reviewRepo.Summary(u.ID)
+		if err != nil {
+			log.Println("reviewRepo.Summary error:", err)
+			return pp
+		}
+		pp.Rating, pp.ReviewCount = rating, count
+		return pp
+	}
+
+	// 一覧 / 詳細に images を付ける（まとめて 1 クエリ）
+	// 画像テーブル導入前の商品は imageUrl をそのまま 1 枚目として返す
+	attachProductImages := func(products []domain.Product) {
+		productIDs := make([]string, len(products))
+		for i := range products {
+			productIDs[i] = products[i].ID
+		}
+		byProduct, err := productImageRepo.ListByProducts(productIDs)
+		if err != nil {
+			log.Println("productImageRepo.ListByProducts error:", err)
+		}
+
+		for i := range products {
+			products[i].ImageURL = coverImageURL(products[i].ImageID, products[i].ImageURL)
+			imgs := byProduct[products[i].ID]
+			for j := range imgs {
+				imgs[j].ThumbURL = imageURL(imgs[j].ImageID, imaging.Thumb.Name)
+				imgs[j].DetailURL = imageURL(imgs[j].ImageID, imaging.Detail.Name)
+			}
+			if len(imgs) == 0 && products[i].ImageURL != "" {
+				imgs = []domain.ProductImage{{
+					IsCover:   true,
+					ThumbURL:  products[i].ImageURL,
+					DetailURL: products[i].ImageURL,
+				}}
+			}
+			if imgs == nil {
+				imgs = []domain.ProductImage{}
+			}
+			products[i].Images = imgs
+		}
+	}
+
+	// 画像を足したり外したりした後、products 側のカバー（image_id / image_url）を合わせる
+	syncCoverImage := func(productID string) {
+		imgs, err := productImageRepo.List(productID)
+		if err != nil {
+			log.Println("productImageRepo.List error:", err)
+			return
+		}
+		coverID := ""
+		for _, img := range imgs {
+			if img.IsCover {
+				coverID = img.ImageID
+			}
+		}
+		if err := store.SetCoverImage(productID, coverID); err != nil {
+			log.Println("store.SetCoverImage error:", err)
+		}
+	}
+
+	// 出品画像を商品に紐づける。本人がアップロードしたものだけ使える
+	resolveProductImage := func(p *domain.Product) map[string]string {
+		if p.ImageID == "" {
+			return nil
+		}
+		img, err := imageRepo.FindByID(p.ImageID)
+		if err != nil || img.OwnerID != p.SellerID {
+			return map[string]string{"imageId": "unknown image"}
+		}
+		p.ImageURL = "" // URL は返すときに id から作る
+		return nil
+	}
+
+	mail, err := mailer.NewFromEnv()
+	if err != nil {
+		log.Fatal("mailer init failed:", err)
+	}
+
+	// チャットのリアルタイム配信（今はプロセス内だけ）
+	var broker pubsub.Broker = pubsub.NewInProcess()
+
+	// オファーの動きを商品チャットのスレッドに流す
+	// メッセージとしても残すので、あとから開いた人・受信箱・未読にも載る
+	publishOffer := func(o domain.Offer, action, by string) {
+		topic := chatTopic(o.ProductID, o.BuyerID, o.SellerID)
+		ev := offerEvent{Action: action, By: by, Offer: o}
+		if err := pubsub.PublishJSON(broker, topic, "offer", ev); err != nil {
+			log.Println("broker.Publish error:", err)
+		}
+
+		to := o.SellerID
+		if by == o.SellerID {
+			to = o.BuyerID
+		}
+		m := domain.Message{
+			ID:         ids.New("m"),
+			ProductID:  o.ProductID,
+			FromUserID: by,
+			ToUserID:   to,
+			Body:       offerMessageBody(action, o.Price),
+			CreatedAt:  time.Now().Format(time.RFC3339),
+		}
+		if err := msgRepo.Create(m); err != nil {
+			log.Println("msgRepo.Create error:", err)
+			return
+		}
+		if err := pubsub.PublishJSON(broker, topic, "message", m); err != nil {
+			log.Println("broker.Publish error:", err)
+		}
+	}
+
+	// 期限切れの pending を定期的に expired にする（読むときは期限で判定しているので遅れても表示は正しい）
+	go func() {
+		for range time.Tick(10 * time.Minute) {
+			if _, err := offerRepo.ExpirePending(time.Now()); err != nil {
+				log.Println("offerRepo.ExpirePending error:", err)
+			}
+		}
+	}()
+
+	// ===== Payment =====
+	var payments payment.Provider
+
+	// 与信OKの注文を売上確定して商品を sold にする
+	// DB 側で失敗したら注文は pending_payment のまま残るので、同じ通知のやり直しで確定できる
+	confirmPayment := func(o domain.Order) error {
+		if in, err := payments.Capture(o.PaymentIntentID); err != nil {
+			// やり直しのときは売上確定済み
+			if !(err == payment.ErrInvalidState && in.Status == payment.StatusCaptured) {
+				log.Println("payments.Capture error:", err)
+				return err
+			}
+		}
+
+		// 商品 sold・注文 paid・預かりをまとめて書く
+		err := orderRepo.MarkPaid(o)
+		if err == repository.ErrProductSold {
+			// 先に他の人の決済が確定していた → 返金して注文を取り消す
+			if _, err := payments.Refund(o.PaymentIntentID); err != nil {
+				log.Println("payments.Refund error:", err)
+			}
+			if err := orderRepo.Transition(o.ID, domain.OrderPendingPayment, domain.OrderCancelled); err != nil {
+				log.Println("orderRepo.Transition error:", err)
+			}
+			return err
+		}
+		if err != nil {
+			log.Println("orderRepo.MarkPaid error:", err)
+			return err
+		}
+		return nil
+	}
+
+	// エラーを返したら webhook は 500 にして、決済代行に再送してもらう
+	handlePaymentEvent := func(ev payment.Event) error {
+		o, err := orderRepo.FindByPaymentIntent(ev.IntentID)
+		if err != nil {
+			log.Println("payment event for unknown intent:", ev.IntentID)
+			return nil
+		}
+		if o.Status != domain.OrderPendingPayment {
+			return nil // 処理済み
+		}
+
+		switch ev.Status {
+		case payment.StatusAuthorized:
+			if err := confirmPayment(o); err != nil && err != repository.ErrProductSold {
+				log.Println("confirmPayment error:", err)
+				return err
+			}
+		case payment.StatusDeclined:
+			if err := orderRepo.Transition(o.ID, domain.OrderPendingPayment, domain.OrderCancelled); err != nil {
+				log.Println("orderRepo.Transition error:", err)
+			}
+		}
+		return nil
+	}
+
+	// fake はプロセス内で直接通知してくる（エラーはログに出ている）
+	payments, err = payment.NewProviderFromEnv(func(ev payment.Event) { handlePaymentEvent(ev) })
+	if err != nil {
+		log.Fatal("payment provider init failed:", err)
+	}
+
+	// 発送後、受取確認がないまま期限を過ぎた預かり金を自動で解放
+	autoReleaseAfter := escrow.AutoReleaseAfter()
+	go escrow.NewAutoReleaser(ledgerRepo, orderRepo, nil).Run(time.Hour)
 
 	// これを消す
 	// likeRepo := repository.NewSQLiteLikeRepository(database)
 	// これに変更
 	likeRepo := repository.NewLikeRepository(database)
 
+	// 自分がいいねしたかを 1 クエリでまとめて引く（tokenがあれば）
+	markLikedByMe := func(r *http.Request, products []domain.Product) {
+		uid, ok := tryGetUserID(r)
+		if !ok || len(products) == 0 {
+			return
+		}
+		productIDs := make([]string, len(products))
+		for i := range products {
+			productIDs[i] = products[i].ID
+		}
+		liked, err := likeRepo.LikedByUser(productIDs, uid)
+		if err != nil {
+			log.Println("likeRepo.LikedByUser error:", err)
+		}
+		for i := range products {
+			products[i].LikedByMe = liked[products[i].ID]
+		}
+	}
+
 	mux := http.NewServeMux()
 
 	// health check
@@ -122,6 +728,7 @@ func main() {
 			DisplayName  string `json:"displayName"`
 			DisplayName2 string `json:"display_name"`
 			MBTI         string `json:"mbti"`
+			Email        string `json:"email"` // 任意。パスワード再設定に使う
 		}
 
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -132,6 +739,21 @@ func main() {
 			http.Error(w, "userId and password are required", http.StatusBadRequest)
 			return
 		}
+		if len(req.UserID) > maxUserIDLen {
+			writeFieldErrors(w, map[string]string{"userId": fmt.Sprintf("must be at most %d bytes", maxUserIDLen)})
+			return
+		}
+		email, msg := normalizeEmail(req.Email)
+		if msg != "" {
+			writeFieldErrors(w, map[string]string{"email": msg})
+			return
+		}
+		if email != "" {
+			if _, err := userRepo.FindByEmail(email); err == nil {
+				writeFieldErrors(w, map[string]string{"email": "already in use"})
+				return
+			}
+		}
 
 		hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 		if err != nil {
@@ -145,6 +767,7 @@ func main() {
 			PasswordHash: string(hash),
 			DisplayName:  req.DisplayName,
 			MBTI:         req.MBTI,
+			Email:        email,
 			CreatedAt:    time.Now().Format(time.RFC3339),
 		})
 		if err != nil {
@@ -156,6 +779,103 @@ func main() {
 		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 	}))
 
+	// ===== Login 総当たり対策 =====
+	// ユーザー / IP ごとに失敗を数えて待たせる・ロックする（今はインスタンスごとのメモリ）
+	loginStore := loginguard.NewMemoryStore(nil)
+	loginLimiter := loginguard.New(loginStore, loginguard.DefaultConfig, nil)
+	go func() {
+		for range time.Tick(10 * time.Minute) {
+			loginStore.Sweep()
+		}
+	}()
+	loginAuditRepo := repository.NewLoginAuditRepository(database)
+
+	recordLoginFailure := func(userID, ip, reason string) {
+		if reason != repository.LoginFailThrottled && loginLimiter.Fail(userID, ip) {
+			log.Printf("login locked: user=%s ip=%s", userID, ip)
+		}
+		if err := loginAuditRepo.RecordFailure(userID, ip, reason, time.Now()); err != nil {
+			log.Println("loginAuditRepo.RecordFailure error:", err)
+		}
+	}
+
+	// ===== 2 段階認証（TOTP） =====
+	totpRepo := repository.NewTOTPRepository(database)
+
+	// TOTP コードかリカバリーコードのどちらかが正しければ nil。間違いは errSecondFactor
+	verifySecondFactor := func(userID, code, recoveryCode string) error {
+		t, err := totpRepo.Find(userID)
+		if err == repository.ErrTOTPNotFound || (err == nil && t.ConfirmedAt == "") {
+			return errSecondFactor
+		}
+		if err != nil {
+			return err
+		}
+
+		if code != "" {
+			step, ok := auth.ValidateTOTP(t.Secret, code, time.Now())
+			if !ok {
+				return errSecondFactor
+			}
+			if err := totpRepo.UseStep(userID, step); err != nil {
+				if err == repository.ErrTOTPCodeUsed {
+					return errSecondFactor
+				}
+				return err
+			}
+			return nil
+		}
+
+		// bcrypt なので 1 件ずつ照合する（最大 10 件）
+		rc := auth.NormalizeRecoveryCode(recoveryCode)
+		hashes, err := totpRepo.UnusedRecoveryCodes(userID)
+		if err != nil {
+			return err
+		}
+		for _, h := range hashes {
+			if bcrypt.CompareHashAndPassword([]byte(h), []byte(rc)) != nil {
+				continue
+			}
+			if err := totpRepo.UseRecoveryCode(userID, h, time.Now()); err != nil {
+				if err == repository.ErrTOTPCodeUsed {
+					return errSecondFactor
+				}
+				return err
+			}
+			return nil
+		}
+		return errSecondFactor
+	}
+
+	// 新しいセッションを始めてアクセストークン / リフレッシュトークンを返す
+	startSession := func(w http.ResponseWriter, userID string) {
+		refresh, hash, err := auth.NewRefreshToken()
+		if err != nil {
+			http.Error(w, "failed to generate token", http.StatusInternalServerError)
+			return
+		}
+		now := time.Now()
+		sess := domain.Session{
+			ID:        ids.New("s"),
+			UserID:    userID,
+			CreatedAt: now.Format(time.RFC3339),
+		}
+		if err := sessionRepo.Start(sess, hash, now.Add(auth.RefreshTokenTTL())); err != nil {
+			log.Println("sessionRepo.Start error:", err)
+			http.Error(w, "failed to generate token", http.StatusInternalServerError)
+			return
+		}
+
+		res, err := newTokenResponse(userID, sess.ID, refresh)
+		if err != nil {
+			http.Error(w, "failed to generate token", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(res)
+	}
+
 	// ===== Login API =====
 	mux.HandleFunc("/login", withCORS(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
@@ -177,63 +897,2000 @@ func main() {
 			return
 		}
 
+		ip := clientIP(r)
+		if wait, err := loginLimiter.Allow(req.UserID, ip); err != nil {
+			recordLoginFailure(req.UserID, ip, repository.LoginFailThrottled)
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			return
+		}
+
 		u, err := userRepo.FindByID(req.UserID)
 		if err != nil {
+			recordLoginFailure(req.UserID, ip, repository.LoginFailUnknownUser)
 			http.Error(w, "invalid credentials", http.StatusUnauthorized)
 			return
 		}
 
 		if err := bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(req.Password)); err != nil {
+			recordLoginFailure(req.UserID, ip, repository.LoginFailBadPassword)
 			http.Error(w, "invalid credentials", http.StatusUnauthorized)
 			return
 		}
 
-		token, err := auth.IssueToken(req.UserID)
-		if err != nil {
-			http.Error(w, "failed to generate token", http.StatusInternalServerError)
+		// 2 段階認証を有効にしている人には、まだトークンを出さずにチャレンジを返す
+		t, err := totpRepo.Find(u.ID)
+		if err != nil && err != repository.ErrTOTPNotFound {
+			log.Println("totpRepo.Find error:", err)
+			http.Error(w, "failed to login", http.StatusInternalServerError)
 			return
 		}
-
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{
-			"token": token,
+		if err == nil && t.ConfirmedAt != "" {
+			// パスワードは合っていたので、この試行は失敗に数えない（コードの方で数える）
+			loginLimiter.Release(u.ID, ip)
+			challenge, err := auth.IssueChallengeToken(u.ID)
+			if err != nil {
+				http.Error(w, "failed to generate token", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]any{
+				"mfaRequired":    true,
+				"challengeToken": challenge,
+				"expiresIn":      int(auth.ChallengeTTL / time.Second),
+			})
+			return
+		}
+
+		loginLimiter.Succeed(u.ID, ip)
+		startSession(w, u.ID)
+	}))
+
+	// ===== 2FA Login API =====
+	// POST /login/2fa  {challengeToken, code} または {challengeToken, recoveryCode}
+	// /login で返したチャレンジと TOTP（かリカバリーコード）を引き換えにトークンを出す
+	mux.HandleFunc("/login/2fa", withCORS(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req struct {
+			ChallengeToken string `json:"challengeToken"`
+			Code           string `json:"code"`
+			RecoveryCode   string `json:"recoveryCode"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ChallengeToken == "" {
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+		if req.Code == "" && req.RecoveryCode == "" {
+			http.Error(w, "code or recoveryCode is required", http.StatusBadRequest)
+			return
+		}
+
+		userID, err := auth.VerifyChallengeToken(req.ChallengeToken)
+		if err != nil {
+			http.Error(w, "invalid or expired challenge", http.StatusUnauthorized)
+			return
+		}
+
+		// コードの総当たりもパスワードと同じ枠で数える
+		ip := clientIP(r)
+		if wait, err := loginLimiter.Allow(userID, ip); err != nil {
+			recordLoginFailure(userID, ip, repository.LoginFailThrottled)
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			return
+		}
+
+		if err := verifySecondFactor(userID, req.Code, req.RecoveryCode); err != nil {
+			if err == errSecondFactor {
+				recordLoginFailure(userID, ip, repository.LoginFailBadTOTP)
+				http.Error(w, "invalid code", http.StatusUnauthorized)
+				return
+			}
+			log.Println("verifySecondFactor error:", err)
+			http.Error(w, "failed to login", http.StatusInternalServerError)
+			return
+		}
+
+		loginLimiter.Succeed(userID, ip)
+		startSession(w, userID)
+	}))
+
+	// ===== 2FA Settings API =====
+	// GET  /me/2fa          {enabled}
+	// POST /me/2fa/enroll   シークレットと otpauth URI を発行（まだ有効にはならない）
+	// POST /me/2fa/confirm  {code} 認証アプリのコードで有効化。リカバリーコードはこのときだけ返す
+	// POST /me/2fa/disable  {code} または {recoveryCode}
+	twoFactorSettings := middleware.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := middleware.UserIDFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		action := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/me/2fa"), "/")
+		if action == "" {
+			if r.Method != http.MethodGet {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			t, err := totpRepo.Find(userID)
+			if err != nil && err != repository.ErrTOTPNotFound {
+				log.Println("totpRepo.Find error:", err)
+				http.Error(w, "failed to load 2fa settings", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]any{"enabled": err == nil && t.ConfirmedAt != ""})
+			return
+		}
+
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req struct {
+			Code         string `json:"code"`
+			RecoveryCode string `json:"recoveryCode"`
+		}
+		if action != "enroll" {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "invalid json", http.StatusBadRequest)
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		switch action {
+		case "enroll":
+			secret, err := auth.NewTOTPSecret()
+			if err != nil {
+				http.Error(w, "failed to generate secret", http.StatusInternalServerError)
+				return
+			}
+			t := domain.TOTP{UserID: userID, Secret: secret, CreatedAt: time.Now().Format(time.RFC3339)}
+			if err := totpRepo.Begin(t); err != nil {
+				if err == repository.ErrTOTPAlreadyEnabled {
+					http.Error(w, err.Error(), http.StatusConflict)
+					return
+				}
+				log.Println("totpRepo.Begin error:", err)
+				http.Error(w, "failed to start 2fa enrollment", http.StatusInternalServerError)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]string{
+				"secret":     secret,
+				"otpauthUri": auth.TOTPURI(userID, secret),
+			})
+
+		case "confirm":
+			t, err := totpRepo.Find(userID)
+			if err != nil {
+				http.Error(w, "call /me/2fa/enroll first", http.StatusConflict)
+				return
+			}
+			if t.ConfirmedAt != "" {
+				http.Error(w, repository.ErrTOTPAlreadyEnabled.Error(), http.StatusConflict)
+				return
+			}
+			step, ok := auth.ValidateTOTP(t.Secret, req.Code, time.Now())
+			if !ok {
+				http.Error(w, "invalid code", http.StatusBadRequest)
+				return
+			}
+
+			codes, err := auth.NewRecoveryCodes()
+			if err != nil {
+				http.Error(w, "failed to generate recovery codes", http.StatusInternalServerError)
+				return
+			}
+			hashes := make([]string, len(codes))
+			for i, c := range codes {
+				h, err := bcrypt.GenerateFromPassword([]byte(c), bcrypt.DefaultCost)
+				if err != nil {
+					http.Error(w, "failed to generate recovery codes", http.StatusInternalServerError)
+					return
+				}
+				hashes[i] = string(h)
+			}
+
+			if err := totpRepo.Confirm(userID, step, hashes, time.Now()); err != nil {
+				if err == repository.ErrTOTPAlreadyEnabled {
+					http.Error(w, err.Error(), http.StatusConflict)
+					return
+				}
+				log.Println("totpRepo.Confirm error:", err)
+				http.Error(w, "failed to enable 2fa", http.StatusInternalServerError)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]any{
+				"enabled":       true,
+				"recoveryCodes": codes,
+			})
+
+		case "disable":
+			// 盗まれたアクセストークンでコードを総当たりされないよう、ログインと同じ枠で数える
+			ip := clientIP(r)
+			if wait, err := loginLimiter.Allow(userID, ip); err != nil {
+				recordLoginFailure(userID, ip, repository.LoginFailThrottled)
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				http.Error(w, err.Error(), http.StatusTooManyRequests)
+				return
+			}
+
+			if err := verifySecondFactor(userID, req.Code, req.RecoveryCode); err != nil {
+				if err == errSecondFactor {
+					recordLoginFailure(userID, ip, repository.LoginFailBadTOTP)
+					http.Error(w, "invalid code", http.StatusBadRequest)
+					return
+				}
+				log.Println("verifySecondFactor error:", err)
+				http.Error(w, "failed to disable 2fa", http.StatusInternalServerError)
+				return
+			}
+			if err := totpRepo.Disable(userID); err != nil {
+				log.Println("totpRepo.Disable error:", err)
+				http.Error(w, "failed to disable 2fa", http.StatusInternalServerError)
+				return
+			}
+			loginLimiter.Succeed(userID, ip)
+			json.NewEncoder(w).Encode(map[string]any{"enabled": false})
+
+		default:
+			http.Error(w, "not found", http.StatusNotFound)
+		}
+	})
+	mux.HandleFunc("/me/2fa", withCORS(twoFactorSettings))
+	mux.HandleFunc("/me/2fa/", withCORS(twoFactorSettings))
+
+	// ===== JWKS =====
+	// 他サービスがこちらのトークンを検証するための公開鍵（RS256 / EdDSA のみ）
+	mux.HandleFunc("/.well-known/jwks.json", withCORS(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		set, err := auth.JWKS()
+		if err != nil {
+			http.Error(w, "keys unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		json.NewEncoder(w).Encode(set)
+	}))
+
+	// ===== Token Refresh API =====
+	// POST /token/refresh  {refreshToken}
+	// 使ったリフレッシュトークンは無効になり、新しいものと新しいアクセストークンを返す
+	// 使用済みのものがもう一度来たら漏えいとみなし、そのセッションごと失効させる
+	mux.HandleFunc("/token/refresh", withCORS(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req struct {
+			RefreshToken string `json:"refreshToken"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+			http.Error(w, "refreshToken is required", http.StatusBadRequest)
+			return
+		}
+
+		refresh, hash, err := auth.NewRefreshToken()
+		if err != nil {
+			http.Error(w, "failed to generate token", http.StatusInternalServerError)
+			return
+		}
+		now := time.Now()
+		sess, err := sessionRepo.Rotate(auth.HashToken(req.RefreshToken), hash, now.Add(auth.RefreshTokenTTL()), now)
+		if err != nil {
+			if err == repository.ErrRefreshTokenReused {
+				log.Println("refresh token reuse detected; session revoked")
+			}
+			if err == repository.ErrRefreshTokenInvalid || err == repository.ErrRefreshTokenReused {
+				http.Error(w, "invalid refresh token", http.StatusUnauthorized)
+				return
+			}
+			log.Println("sessionRepo.Rotate error:", err)
+			http.Error(w, "failed to refresh token", http.StatusInternalServerError)
+			return
+		}
+
+		res, err := newTokenResponse(sess.UserID, sess.ID, refresh)
+		if err != nil {
+			http.Error(w, "failed to generate token", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(res)
+	}))
+
+	// ===== Logout API =====
+	// POST /logout      今のセッション（この端末）だけ失効
+	// POST /logout-all  自分の全セッションを失効
+	mux.HandleFunc("/logout", withCORS(
+		middleware.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+
+			userID, ok := middleware.UserIDFromContext(r.Context())
+			sessionID, ok2 := middleware.SessionIDFromContext(r.Context())
+			if !ok || !ok2 {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			if err := sessionRepo.Revoke(sessionID, userID, time.Now()); err != nil {
+				log.Println("sessionRepo.Revoke error:", err)
+				http.Error(w, "failed to logout", http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+		}),
+	))
+
+	mux.HandleFunc("/logout-all", withCORS(
+		middleware.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+
+			userID, ok := middleware.UserIDFromContext(r.Context())
+			if !ok {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			n, err := sessionRepo.RevokeAll(userID, time.Now())
+			if err != nil {
+				log.Println("sessionRepo.RevokeAll error:", err)
+				http.Error(w, "failed to logout", http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]any{"status": "ok", "revokedSessions": n})
+		}),
+	))
+
+	// ===== Me API =====
+	mux.HandleFunc("/me", withCORS(
+		middleware.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+
+			userID, ok := middleware.UserIDFromContext(r.Context())
+			if !ok {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			u, err := userRepo.FindByID(userID)
+			if err != nil {
+				http.Error(w, "user not found", http.StatusNotFound)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{
+				"userId":      u.ID,
+				"displayName": u.DisplayName,
+				"mbti":        u.MBTI,
+				"email":       u.Email,
+			})
+		}),
+	))
+
+	// ===== Password API =====
+	// POST /me/password  {currentPassword, newPassword}
+	// 変更したら、この端末以外のセッションはログアウトさせる
+	mux.HandleFunc("/me/password", withCORS(
+		middleware.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+
+			userID, ok := middleware.UserIDFromContext(r.Context())
+			sessionID, ok2 := middleware.SessionIDFromContext(r.Context())
+			if !ok || !ok2 {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			var req struct {
+				CurrentPassword string `json:"currentPassword"`
+				NewPassword     string `json:"newPassword"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "invalid json", http.StatusBadRequest)
+				return
+			}
+			if msg := validatePassword(req.NewPassword); msg != "" {
+				writeFieldErrors(w, map[string]string{"newPassword": msg})
+				return
+			}
+
+			u, err := userRepo.FindByID(userID)
+			if err != nil {
+				http.Error(w, "user not found", http.StatusNotFound)
+				return
+			}
+			if !checkCurrentPassword(w, r, loginLimiter, recordLoginFailure, u, req.CurrentPassword) {
+				return
+			}
+
+			hash, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+			if err != nil {
+				http.Error(w, "failed to update password", http.StatusInternalServerError)
+				return
+			}
+			if err := userRepo.UpdatePasswordHash(u.ID, string(hash)); err != nil {
+				log.Println("userRepo.UpdatePasswordHash error:", err)
+				http.Error(w, "failed to update password", http.StatusInternalServerError)
+				return
+			}
+			if _, err := sessionRepo.RevokeOthers(u.ID, sessionID, time.Now()); err != nil {
+				log.Println("sessionRepo.RevokeOthers error:", err)
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+		}),
+	))
+
+	// PUT /me/email  {email, currentPassword}  再設定メールの送り先。空文字で解除
+	// 乗っ取ったトークンだけで送り先を変えられないようにパスワードも求める
+	mux.HandleFunc("/me/email", withCORS(
+		middleware.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPut {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+
+			userID, ok := middleware.UserIDFromContext(r.Context())
+			if !ok {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			var req struct {
+				Email           string `json:"email"`
+				CurrentPassword string `json:"currentPassword"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "invalid json", http.StatusBadRequest)
+				return
+			}
+			email, msg := normalizeEmail(req.Email)
+			if msg != "" {
+				writeFieldErrors(w, map[string]string{"email": msg})
+				return
+			}
+
+			u, err := userRepo.FindByID(userID)
+			if err != nil {
+				http.Error(w, "user not found", http.StatusNotFound)
+				return
+			}
+			if !checkCurrentPassword(w, r, loginLimiter, recordLoginFailure, u, req.CurrentPassword) {
+				return
+			}
+			if email != "" {
+				if other, err := userRepo.FindByEmail(email); err == nil && other.ID != u.ID {
+					writeFieldErrors(w, map[string]string{"email": "already in use"})
+					return
+				}
+			}
+
+			if err := userRepo.UpdateEmail(u.ID, email); err != nil {
+				log.Println("userRepo.UpdateEmail error:", err)
+				http.Error(w, "failed to update email", http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"email": email})
+		}),
+	))
+
+	// ===== Password Reset API =====
+	// POST /password-reset/request  {email}
+	// 登録の有無に関わらず 202 を返す（アドレスの存在を漏らさない）
+	mux.HandleFunc("/password-reset/request", withCORS(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req struct {
+			Email string `json:"email"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+		email, msg := normalizeEmail(req.Email)
+		if msg != "" || email == "" {
+			writeFieldErrors(w, map[string]string{"email": "must be a valid email address"})
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+
+		// 応答時間で登録の有無がわからないよう、発行と送信は応答のあとでやる
+		go func() {
+			u, err := userRepo.FindByEmail(email)
+			if err != nil {
+				if err != repository.ErrUserNotFound {
+					log.Println("userRepo.FindByEmail error:", err)
+				}
+				return
+			}
+
+			now := time.Now()
+			if recent, err := resetRepo.IssuedSince(u.ID, now.Add(-passwordResetCooldown)); err != nil {
+				log.Println("resetRepo.IssuedSince error:", err)
+				return
+			} else if recent {
+				return
+			}
+
+			token, hash, err := auth.NewPasswordResetToken()
+			if err != nil {
+				log.Println("auth.NewPasswordResetToken error:", err)
+				return
+			}
+			if err := resetRepo.Create(hash, u.ID, now.Add(passwordResetTTL), now); err != nil {
+				log.Println("resetRepo.Create error:", err)
+				return
+			}
+
+			link := resetURL + "?token=" + url.QueryEscape(token)
+			err = mail.Send(mailer.Message{
+				To:      u.Email,
+				Subject: "【freemarket】パスワード再設定のご案内",
+				Body: fmt.Sprintf(
+					"%s さん\n\n以下のリンクからパスワードを再設定してください（%d 分間有効・1 回限り）。\n\n%s\n\n"+
+						"心当たりがない場合はこのメールを破棄してください。パスワードは変更されません。\n",
+					u.DisplayName, int(passwordResetTTL/time.Minute), link,
+				),
+			})
+			if err != nil {
+				log.Println("mail.Send error:", err)
+			}
+		}()
+	}))
+
+	// POST /password-reset/confirm  {token, newPassword}
+	// 成功したら全セッションをログアウトさせる
+	mux.HandleFunc("/password-reset/confirm", withCORS(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req struct {
+			Token       string `json:"token"`
+			NewPassword string `json:"newPassword"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+		if msg := validatePassword(req.NewPassword); msg != "" {
+			writeFieldErrors(w, map[string]string{"newPassword": msg})
+			return
+		}
+
+		hash, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+		if err != nil {
+			http.Error(w, "failed to update password", http.StatusInternalServerError)
+			return
+		}
+
+		now := time.Now()
+		userID, err := resetRepo.Reset(auth.HashToken(req.Token), string(hash), now)
+		if err != nil {
+			if err == repository.ErrResetTokenInvalid {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			log.Println("resetRepo.Reset error:", err)
+			http.Error(w, "failed to reset password", http.StatusInternalServerError)
+			return
+		}
+		if _, err := sessionRepo.RevokeAll(userID, now); err != nil {
+			log.Println("sessionRepo.RevokeAll error:", err)
+		}
+		// 本人が再設定できたのでロックも解く
+		loginLimiter.Unlock(userID)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	}))
+
+	// ===== Balance API =====
+	// GET /me/balance  出品者としての預かり中 / 解放済みの売上と、購入者として支払ったお金（asBuyer）
+	mux.HandleFunc("/me/balance", withCORS(
+		middleware.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+
+			userID, ok := middleware.UserIDFromContext(r.Context())
+			if !ok {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			b, err := ledgerRepo.Balance(userID)
+			if err != nil {
+				log.Println("ledgerRepo.Balance error:", err)
+				http.Error(w, "failed to load balance", http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(b)
+		}),
+	))
+
+	// ===== My Sales / Purchases API =====
+	// GET /me/sales      自分が売った注文（商品名・画像つき）
+	// GET /me/purchases  自分が買った注文
+	myOrders := func(list func(userID string) ([]domain.OrderSummary, error)) http.HandlerFunc {
+		return withCORS(middleware.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+
+			userID, ok := middleware.UserIDFromContext(r.Context())
+			if !ok {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			orders, err := list(userID)
+			if err != nil {
+				log.Println("list orders error:", err)
+				http.Error(w, "failed to list orders", http.StatusInternalServerError)
+				return
+			}
+			for i := range orders {
+				orders[i].ProductImageURL = coverImageURL(orders[i].ProductImageID, orders[i].ProductImageURL)
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(orders)
+		}))
+	}
+	mux.HandleFunc("/me/sales", myOrders(orderRepo.ListSales))
+	mux.HandleFunc("/me/purchases", myOrders(orderRepo.ListPurchases))
+
+	// ===== Likes API (toggle) =====
+	// POST /likes  { productId: "p_xxx" }
+	// Authorization: Bearer <token>
+	// → 既にいいね済みなら Unlike、未いいねなら Like（= toggle）
+	mux.HandleFunc("/likes", withCORS(
+		middleware.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+
+			var req struct {
+				ProductID string `json:"productId"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ProductID == "" {
+				http.Error(w, "invalid request", http.StatusBadRequest)
+				return
+			}
+
+			userID, ok := middleware.UserIDFromContext(r.Context())
+			if !ok {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			liked, err := likeRepo.IsLiked(req.ProductID, userID)
+			if err != nil {
+				log.Println("likeRepo.IsLiked error:", err)
+				http.Error(w, "failed to check like", http.StatusInternalServerError)
+				return
+			}
+
+			if liked {
+				if err := likeRepo.Unlike(req.ProductID, userID); err != nil {
+					log.Println("likeRepo.Unlike error:", err)
+					http.Error(w, "failed to unlike", http.StatusInternalServerError)
+					return
+				}
+			} else {
+				if err := likeRepo.Like(req.ProductID, userID); err != nil {
+					log.Println("likeRepo.Like error:", err)
+					http.Error(w, "failed to like", http.StatusInternalServerError)
+					return
+				}
+			}
+
+			cnt, err := likeRepo.CountByProduct(req.ProductID)
+			if err != nil {
+				log.Println("likeRepo.CountByProduct error:", err)
+				http.Error(w, "failed to count likes", http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			// フロント(toggleLike)は { liked, likeCount } を期待してるのでそれに合わせる
+			json.NewEncoder(w).Encode(map[string]any{
+				"liked":     !liked,
+				"likeCount": cnt,
+			})
+		}),
+	))
+
+	// ===== Product API =====
+	mux.HandleFunc("/products", withCORS(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.Method {
+		case http.MethodGet:
+			q, err := parseProductQuery(r)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			products, next, err := store.List(q)
+			if err == repository.ErrInvalidCursor {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err != nil {
+				log.Println("store.List error:", err)
+				http.Error(w, "failed to list products", http.StatusInternalServerError)
+				return
+			}
+
+			// body は今まで通り配列のまま。次ページのカーソルはヘッダで返す
+			if next != "" {
+				w.Header().Set("X-Next-Cursor", next)
+			}
+
+			// いいね数は List の集計で取れている
+			markLikedByMe(r, products)
+			attachProductImages(products)
+
+			json.NewEncoder(w).Encode(products)
+
+		case http.MethodPost:
+			// 出品はログイン必須。出品者はトークンから決める
+			middleware.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+				userID, ok := middleware.UserIDFromContext(r.Context())
+				if !ok {
+					http.Error(w, "unauthorized", http.StatusUnauthorized)
+					return
+				}
+
+				var p domain.Product
+				if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+					http.Error(w, "invalid request body", http.StatusBadRequest)
+					return
+				}
+				if p.ImageURL != "" {
+					writeFieldErrors(w, map[string]string{"imageUrl": rawImageURLError})
+					return
+				}
+
+				// body の sellerId は互換のため受け付けるが、本人以外は拒否
+				if p.SellerID != "" && p.SellerID != userID {
+					writeFieldErrors(w, map[string]string{"sellerId": "must match the authenticated user"})
+					return
+				}
+				p.SellerID = userID
+
+				p.ID = ids.New("p")
+				p.CreatedAt = time.Now().Format(time.RFC3339)
+
+				// status デフォルト
+				if p.Status == "" {
+					p.Status = "available"
+				}
+
+				// considering のときは価格を 0 扱い（価格未定）
+				if p.Status == "considering" {
+					p.Price = 0
+				}
+
+				if errs := resolveProductImage(&p); errs != nil {
+					writeFieldErrors(w, errs)
+					return
+				}
+				if errs := validateProduct(p); len(errs) > 0 {
+					writeFieldErrors(w, errs)
+					return
+				}
+
+				if err := store.Create(p); err != nil {
+					http.Error(w, "failed to create product", http.StatusInternalServerError)
+					return
+				}
+
+				// imageId はそのまま 1 枚目（カバー）になる。2 枚目以降は POST /products/{id}/images
+				if p.ImageID != "" {
+					if err := productImageRepo.Add(p.ID, p.ImageID); err != nil {
+						log.Println("productImageRepo.Add error:", err)
+					}
+				}
+				ps := []domain.Product{p}
+				attachProductImages(ps)
+				p = ps[0]
+
+				w.WriteHeader(http.StatusCreated)
+				json.NewEncoder(w).Encode(p)
+			})(w, r)
+
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+
+	// ===== Quote Requests API =====
+	// POST /products/{id}/quote-requests  {message}  価格未定（considering）の出品に値段を聞く
+	// GET  /products/{id}/quote-requests             出品者のみ。届いたリクエスト一覧
+	quoteRequests := middleware.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := middleware.UserIDFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		productID := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/products/"), "/quote-requests")
+		if !ids.Valid("p", productID) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+
+		p, err := store.FindByID(productID)
+		if err != nil {
+			http.Error(w, "product not found", http.StatusNotFound)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			if p.SellerID != userID {
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+			reqs, err := quoteRepo.ListByProduct(p.ID)
+			if err != nil {
+				log.Println("quoteRepo.ListByProduct error:", err)
+				http.Error(w, "failed to list quote requests", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(reqs)
+
+		case http.MethodPost:
+			if p.SellerID == userID {
+				http.Error(w, "cannot request a quote for your own product", http.StatusBadRequest)
+				return
+			}
+			if p.Status != "considering" {
+				http.Error(w, "product already has a price", http.StatusConflict)
+				return
+			}
+
+			var req struct {
+				Message string `json:"message"`
+			}
+			// 本文なしでも受け付ける
+			if r.ContentLength != 0 {
+				if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+					http.Error(w, "invalid json", http.StatusBadRequest)
+					return
+				}
+			}
+			req.Message = strings.TrimSpace(req.Message)
+			if utf8.RuneCountInString(req.Message) > maxQuoteMessageLen {
+				writeFieldErrors(w, map[string]string{
+					"message": fmt.Sprintf("must be at most %d characters", maxQuoteMessageLen),
+				})
+				return
+			}
+
+			q := domain.QuoteRequest{
+				ProductID:   p.ID,
+				RequesterID: userID,
+				Message:     req.Message,
+				CreatedAt:   time.Now().Format(time.RFC3339),
+			}
+			if err := quoteRepo.Create(q); err != nil {
+				if err == repository.ErrQuoteRequestExists {
+					http.Error(w, err.Error(), http.StatusConflict)
+					return
+				}
+				log.Println("quoteRepo.Create error:", err)
+				http.Error(w, "failed to save quote request", http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(q)
+
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	// 価格が決まったことを、まだ知らせていないリクエスト者にチャットで送る（受信箱・未読に載る）
+	notifyQuoteRequesters := func(p domain.Product) {
+		reqs, err := quoteRepo.ListByProduct(p.ID)
+		if err != nil {
+			log.Println("quoteRepo.ListByProduct error:", err)
+			return
+		}
+		for _, q := range reqs {
+			if q.NotifiedAt != "" {
+				continue
+			}
+			m := domain.Message{
+				ID:         ids.New("m"),
+				ProductID:  p.ID,
+				FromUserID: p.SellerID,
+				ToUserID:   q.RequesterID,
+				Body:       fmt.Sprintf("「%s」の価格が決まりました: ¥%d", p.Title, p.Price),
+				CreatedAt:  time.Now().Format(time.RFC3339),
+			}
+			if err := msgRepo.Create(m); err != nil {
+				log.Println("msgRepo.Create error:", err)
+				continue
+			}
+			if err := pubsub.PublishJSON(broker, chatTopic(p.ID, p.SellerID, q.RequesterID), "message", m); err != nil {
+				log.Println("broker.Publish error:", err)
+			}
+			if err := quoteRepo.MarkNotified(p.ID, q.RequesterID, m.CreatedAt); err != nil {
+				log.Println("quoteRepo.MarkNotified error:", err)
+			}
+		}
+	}
+
+	// ===== Product Status API =====
+	// POST /products/{id}/status  {status, price}
+	// considering → available は価格必須。available → considering は価格を 0 に戻す
+	// sold からはどこへも戻せない。出品者本人のみ（/products/{id} 側でチェック済み）
+	transitionProduct := func(w http.ResponseWriter, r *http.Request, p domain.Product) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req struct {
+			Status string `json:"status"`
+			Price  int    `json:"price"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+		if !domain.CanTransitionProduct(p.Status, req.Status) {
+			http.Error(w, "cannot change product from "+p.Status+" to "+req.Status, http.StatusConflict)
+			return
+		}
+
+		from := p.Status
+		p.Status = req.Status
+		p.Price = req.Price
+		if p.Status == "considering" {
+			p.Price = 0
+		}
+		if errs := validateProduct(p); len(errs) > 0 {
+			writeFieldErrors(w, errs)
+			return
+		}
+
+		// 承諾済みオファーの取り置き中は価格未定に戻せない
+		if p.Status == "considering" {
+			if _, err := offerRepo.ActiveReservation(p.ID, time.Now()); err == nil {
+				http.Error(w, repository.ErrProductReserved.Error(), http.StatusConflict)
+				return
+			} else if err != repository.ErrOfferNotFound {
+				log.Println("offerRepo.ActiveReservation error:", err)
+				http.Error(w, "failed to update product", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		if err := store.Transition(p.ID, p.SellerID, from, p.Status, p.Price); err != nil {
+			if err == repository.ErrInvalidProductTransition {
+				// 直前に売れた / 削除された / 別リクエストで切り替わった
+				http.Error(w, "cannot change product from "+from+" to "+p.Status, http.StatusConflict)
+				return
+			}
+			log.Println("store.Transition error:", err)
+			http.Error(w, "failed to update product", http.StatusInternalServerError)
+			return
+		}
+
+		if p.Status == "available" {
+			notifyQuoteRequesters(p)
+		}
+
+		ps := []domain.Product{p}
+		attachProductImages(ps)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ps[0])
+	}
+
+	// ===== Product Images API =====
+	// POST   /products/{id}/images            { imageId }                 末尾に追加
+	// PUT    /products/{id}/images            { imageIds, coverImageId }  並べ替え（+ カバー変更）
+	// DELETE /products/{id}/images/{imageId}                               外す
+	// 出品者本人のみ（/products/{id} 側でチェック済み）。どれも更新後の images を返す
+	handleProductImages := func(w http.ResponseWriter, r *http.Request, p domain.Product, rest []string) {
+		if p.Status == "sold" {
+			http.Error(w, repository.ErrProductSold.Error(), http.StatusConflict)
+			return
+		}
+
+		var err error
+		switch {
+		case r.Method == http.MethodPost && len(rest) == 0:
+			var req struct {
+				ImageID string `json:"imageId"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ImageID == "" {
+				http.Error(w, "imageId is required", http.StatusBadRequest)
+				return
+			}
+			img, ferr := imageRepo.FindByID(req.ImageID)
+			if ferr != nil || img.OwnerID != p.SellerID {
+				http.Error(w, "unknown image", http.StatusBadRequest)
+				return
+			}
+			err = productImageRepo.Add(p.ID, img.ID)
+
+		case r.Method == http.MethodPut && len(rest) == 0:
+			var req struct {
+				ImageIDs     []string `json:"imageIds"`
+				CoverImageID string   `json:"coverImageId"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "invalid request body", http.StatusBadRequest)
+				return
+			}
+			err = productImageRepo.Reorder(p.ID, req.ImageIDs)
+			if err == nil && req.CoverImageID != "" {
+				err = productImageRepo.SetCover(p.ID, req.CoverImageID)
+			}
+
+		case r.Method == http.MethodDelete && len(rest) == 1:
+			err = productImageRepo.Remove(p.ID, rest[0])
+
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		switch err {
+		case nil:
+		case repository.ErrProductImageNotFound:
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case repository.ErrProductImageExists, repository.ErrTooManyProductImages, repository.ErrInvalidImageOrder:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		default:
+			log.Println("product images error:", err)
+			http.Error(w, "failed to update images", http.StatusInternalServerError)
+			return
+		}
+
+		syncCoverImage(p.ID)
+
+		p, err = store.FindByID(p.ID)
+		if err != nil {
+			http.Error(w, "failed to load product", http.StatusInternalServerError)
+			return
+		}
+		ps := []domain.Product{p}
+		attachProductImages(ps)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ps[0].Images)
+	}
+
+	// ===== Product Edit / Delete API =====
+	// PUT    /products/{id}  title, price, description, imageUrl をまとめて更新
+	// PATCH  /products/{id}  送られた項目だけ更新
+	// DELETE /products/{id}  論理削除
+	// （画像の追加 / 並べ替え / 削除は /products/{id}/images、ステータス切り替えは /products/{id}/status）
+	// どれも出品者本人のみ。売れた商品は編集できない
+	editProduct := middleware.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := middleware.UserIDFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/products/"), "/")
+		productID := parts[0]
+		if !ids.Valid("p", productID) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+
+		p, err := store.FindByID(productID)
+		if err != nil {
+			http.Error(w, "product not found", http.StatusNotFound)
+			return
+		}
+		if p.SellerID != userID {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		if len(parts) == 2 && parts[1] == "status" {
+			transitionProduct(w, r, p)
+			return
+		}
+		if len(parts) > 1 {
+			if parts[1] != "images" || len(parts) > 3 {
+				http.Error(w, "not found", http.StatusNotFound)
+				return
+			}
+			handleProductImages(w, r, p, parts[2:])
+			return
+		}
+
+		switch r.Method {
+		case http.MethodPut, http.MethodPatch:
+			if p.Status == "sold" {
+				http.Error(w, repository.ErrProductSold.Error(), http.StatusConflict)
+				return
+			}
+
+			var req struct {
+				Title       *string `json:"title"`
+				Price       *int    `json:"price"`
+				Description *string `json:"description"`
+				ImageURL    *string `json:"imageUrl"`
+				ImageID     *string `json:"imageId"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "invalid request body", http.StatusBadRequest)
+				return
+			}
+			if r.Method == http.MethodPut && (req.Title == nil || req.Price == nil || req.Description == nil) {
+				http.Error(w, "title, price and description are required", http.StatusBadRequest)
+				return
+			}
+
+			if req.Title != nil {
+				p.Title = *req.Title
+			}
+			if req.Price != nil {
+				p.Price = *req.Price
+			}
+			if req.Description != nil {
+				p.Description = *req.Description
+			}
+			// imageUrl は "" でカバーを外すときだけ
+			if req.ImageURL != nil {
+				if *req.ImageURL != "" {
+					writeFieldErrors(w, map[string]string{"imageUrl": rawImageURLError})
+					return
+				}
+				p.ImageURL = ""
+				p.ImageID = ""
+			}
+			if req.ImageID != nil {
+				p.ImageID = *req.ImageID
+				if p.ImageID == "" {
+					p.ImageURL = ""
+				}
+			}
+			if errs := resolveProductImage(&p); errs != nil {
+				writeFieldErrors(w, errs)
+				return
+			}
+
+			// considering のときは価格を 0 扱い（価格未定）
+			if p.Status == "considering" {
+				p.Price = 0
+			}
+
+			if errs := validateProduct(p); len(errs) > 0 {
+				writeFieldErrors(w, errs)
+				return
+			}
+
+			// 画像一覧も一緒に更新する（imageId はカバーとして一覧に入る。空ならカバーも一覧も外れる）
+			if err := store.Update(p); err != nil {
+				if err == repository.ErrProductNotFound {
+					// 直前に売れた / 削除された
+					http.Error(w, "product not found or already sold", http.StatusConflict)
+					return
+				}
+				if err == repository.ErrTooManyProductImages {
+					writeFieldErrors(w, map[string]string{"imageId": err.Error()})
+					return
+				}
+				log.Println("store.Update error:", err)
+				http.Error(w, "failed to update product", http.StatusInternalServerError)
+				return
+			}
+
+			ps := []domain.Product{p}
+			attachProductImages(ps)
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(ps[0])
+
+		case http.MethodDelete:
+			if err := store.Delete(p.ID, userID); err != nil {
+				if err == repository.ErrProductNotFound {
+					http.Error(w, "product not found", http.StatusNotFound)
+					return
+				}
+				log.Println("store.Delete error:", err)
+				http.Error(w, "failed to delete product", http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	// ===== Product Detail API =====
+	// GET /products/{id}  商品 + いいね数 + likedByMe（tokenがあれば）+ 出品者プロフィール + 画像
+	// ETag を付けるので、変わっていなければ If-None-Match で 304
+	productDetail := func(w http.ResponseWriter, r *http.Request) {
+		productID := strings.TrimPrefix(r.URL.Path, "/products/")
+		if !ids.Valid("p", productID) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+
+		// 削除済みでも、注文やチャットから開く出品者・買い手には見せる
+		p, err := store.FindByIDIncludingDeleted(productID)
+		if err != nil {
+			http.Error(w, "product not found", http.StatusNotFound)
+			return
+		}
+		uid, loggedIn := tryGetUserID(r)
+		party := loggedIn && (uid == p.SellerID || uid == p.BuyerID)
+		if p.Deleted && !party {
+			http.Error(w, "product not found", http.StatusNotFound)
+			return
+		}
+		if !party {
+			p.BuyerID = ""
+		}
+
+		if p.LikeCount, err = likeRepo.CountByProduct(p.ID); err != nil {
+			log.Println("likeRepo.CountByProduct error:", err)
+		}
+		if loggedIn {
+			if p.LikedByMe, err = likeRepo.IsLiked(p.ID, uid); err != nil {
+				log.Println("likeRepo.IsLiked error:", err)
+			}
+		}
+
+		ps := []domain.Product{p}
+		attachProductImages(ps)
+
+		seller := domain.PublicProfile{UserID: p.SellerID}
+		if u, err := userRepo.FindByID(p.SellerID); err == nil {
+			seller = publicProfile(u)
+		}
+
+		body, err := json.Marshal(struct {
+			domain.Product
+			Seller domain.PublicProfile `json:"seller"`
+		}{ps[0], seller})
+		if err != nil {
+			http.Error(w, "failed to encode product", http.StatusInternalServerError)
+			return
+		}
+
+		sum := sha256.Sum256(body)
+		etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+		// likedByMe がユーザーごとに違うので共有キャッシュには載せない
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", "private, no-cache")
+		w.Header().Set("Vary", "Origin, Authorization")
+
+		if etagMatches(r.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+		w.Write([]byte("\n"))
+	}
+
+	// 詳細は誰でも見られる。それ以外（編集・削除・画像）はログイン必須
+	mux.HandleFunc("/products/", withCORS(func(w http.ResponseWriter, r *http.Request) {
+		// 出品者以外も使うので editProduct の本人チェックより前に振り分ける
+		if strings.HasSuffix(r.URL.Path, "/quote-requests") {
+			quoteRequests(w, r)
+			return
+		}
+		if r.Method == http.MethodGet {
+			productDetail(w, r)
+			return
+		}
+		editProduct(w, r)
+	}))
+
+	// ===== Uploads API =====
+	// POST /uploads  multipart の "file" に出品画像 1 枚
+	// 中身で形式を判定し、サムネイル / 詳細サイズの JPEG を作り直して保存する（EXIF・位置情報は落ちる）
+	// 返ってきた id を POST /products の imageId に入れて使う
+	mux.HandleFunc("/uploads", withCORS(
+		middleware.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+
+			userID, ok := middleware.UserIDFromContext(r.Context())
+			if !ok {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize+1<<20)
+			file, _, err := r.FormFile("file")
+			if err != nil {
+				http.Error(w, "file is required (max 10MB)", http.StatusBadRequest)
+				return
+			}
+			defer file.Close()
+
+			data, err := io.ReadAll(io.LimitReader(file, maxUploadSize+1))
+			if err != nil {
+				http.Error(w, "failed to read file", http.StatusBadRequest)
+				return
+			}
+			if len(data) > maxUploadSize {
+				http.Error(w, "file too large (max 10MB)", http.StatusRequestEntityTooLarge)
+				return
+			}
+
+			src, _, err := imaging.Decode(data)
+			if err == imaging.ErrTooLarge {
+				http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+				return
+			}
+			if err != nil {
+				http.Error(w, "unsupported image (jpeg, png, gif only)", http.StatusUnsupportedMediaType)
+				return
+			}
+
+			img := domain.Image{
+				ID:        ids.New("img"),
+				OwnerID:   userID,
+				CreatedAt: time.Now().Format(time.RFC3339),
+			}
+
+			variants, err := imaging.EncodeVariants(src, imaging.Detail, imaging.Thumb)
+			if err != nil {
+				log.Println("imaging.EncodeVariants error:", err)
+				http.Error(w, "failed to process image", http.StatusInternalServerError)
+				return
+			}
+			for _, v := range variants {
+				if err := blobs.Put(imageKey(img.ID, v.Variant.Name), bytes.NewReader(v.Data), "image/jpeg"); err != nil {
+					log.Println("blobs.Put error:", err)
+					http.Error(w, "failed to store image", http.StatusInternalServerError)
+					return
+				}
+				if v.Variant == imaging.Detail {
+					img.Width, img.Height = v.Width, v.Height
+				}
+			}
+
+			if err := imageRepo.Create(img); err != nil {
+				log.Println("imageRepo.Create error:", err)
+				http.Error(w, "failed to save image", http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(withImageURLs(img))
+		}),
+	))
+
+	// GET /uploads/{id}/thumb | /uploads/{id}/detail  出品画像は公開
+	mux.HandleFunc("/uploads/", withCORS(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/uploads/"), "/")
+		if len(parts) != 2 || !ids.Valid("img", parts[0]) ||
+			(parts[1] != imaging.Thumb.Name && parts[1] != imaging.Detail.Name) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+
+		rc, _, err := blobs.Get(imageKey(parts[0], parts[1]))
+		if err != nil {
+			if err != storage.ErrNotFound {
+				log.Println("blobs.Get error:", err)
+			}
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		defer rc.Close()
+
+		// 同じ id の中身は変わらない
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		io.Copy(w, rc)
+	}))
+
+	// ===== GEMINI API =====
+	mux.HandleFunc("/ai/product-summary", withCORS(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req struct {
+			ProductID string `json:"productId"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ProductID == "" {
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+
+		p, err := store.FindByID(req.ProductID)
+		if err != nil {
+			http.Error(w, "product not found", http.StatusNotFound)
+			return
+		}
+
+		text, err := auth.GenerateProductSummary(p)
+		if err != nil {
+			log.Println("GenerateProductSummary error:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"text": text,
 		})
 	}))
 
-	// ===== Me API =====
-	mux.HandleFunc("/me", withCORS(
-		middleware.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
-			if r.Method != http.MethodGet {
-				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	// ===== Messages API =====
+	// 商品単位で会話するので query に productId 必須
+	mux.HandleFunc("/messages", withCORS(
+		middleware.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+			userID, ok := middleware.UserIDFromContext(r.Context())
+			if !ok {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			switch r.Method {
+			case http.MethodGet:
+				other := r.URL.Query().Get("otherUserId")
+				productID := r.URL.Query().Get("productId")
+				if other == "" || productID == "" {
+					http.Error(w, "otherUserId and productId are required", http.StatusBadRequest)
+					return
+				}
+
+				// ?limit=&before=<messageId> / &after=<messageId>
+				page := repository.ConversationPage{
+					Before: r.URL.Query().Get("before"),
+					After:  r.URL.Query().Get("after"),
+				}
+				if page.Before != "" && page.After != "" {
+					http.Error(w, "before and after cannot be used together", http.StatusBadRequest)
+					return
+				}
+				if v := r.URL.Query().Get("limit"); v != "" {
+					n, err := strconv.Atoi(v)
+					if err != nil || n <= 0 {
+						http.Error(w, "invalid limit", http.StatusBadRequest)
+						return
+					}
+					page.Limit = n
+				}
+
+				msgs, hasMore, err := msgRepo.ListConversationPage(userID, other, productID, page)
+				if err == repository.ErrMessageNotFound {
+					http.Error(w, "cursor message not found", http.StatusBadRequest)
+					return
+				}
+				if err != nil {
+					http.Error(w, "failed to list messages", http.StatusInternalServerError)
+					return
+				}
+
+				// 添付はページ分まとめて引く
+				msgIDs := make([]string, len(msgs))
+				for i := range msgs {
+					msgIDs[i] = msgs[i].ID
+				}
+				atts, err := attachRepo.ListByMessages(msgIDs)
+				if err != nil {
+					log.Println("attachRepo.ListByMessages error:", err)
+				}
+				for i := range msgs {
+					msgs[i].Attachments = atts[msgs[i].ID]
+				}
+
+				// body は配列のまま。続きがあるかはヘッダで
+				w.Header().Set("X-Has-More", strconv.FormatBool(hasMore))
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(msgs)
+
+			case http.MethodPost:
+				var req struct {
+					ToUserID      string   `json:"toUserId"`
+					ProductID     string   `json:"productId"`
+					Body          string   `json:"body"`
+					AttachmentIDs []string `json:"attachmentIds"` // POST /messages/attachments で上げたもの
+				}
+				if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+					http.Error(w, "invalid request", http.StatusBadRequest)
+					return
+				}
+				// 添付があれば本文なしでも送れる
+				if req.ToUserID == "" || req.ProductID == "" || (req.Body == "" && len(req.AttachmentIDs) == 0) {
+					http.Error(w, "toUserId, productId and body (or attachmentIds) are required", http.StatusBadRequest)
+					return
+				}
+				if len(req.AttachmentIDs) > maxAttachmentsPerMessage {
+					http.Error(w, fmt.Sprintf("at most %d attachments per message", maxAttachmentsPerMessage), http.StatusBadRequest)
+					return
+				}
+
+				m := domain.Message{
+					ID:         ids.New("m"),
+					ProductID:  req.ProductID,
+					FromUserID: userID,
+					ToUserID:   req.ToUserID,
+					Body:       req.Body,
+					CreatedAt:  time.Now().Format(time.RFC3339),
+				}
+
+				if err := attachRepo.AttachToMessage(m.ID, userID, req.AttachmentIDs); err != nil {
+					if err == repository.ErrAttachmentUnavailable {
+						http.Error(w, "invalid attachmentIds", http.StatusBadRequest)
+						return
+					}
+					log.Println("attachRepo.AttachToMessage error:", err)
+					http.Error(w, "failed to send message", http.StatusInternalServerError)
+					return
+				}
+
+				if err := msgRepo.Create(m); err != nil {
+					if err := attachRepo.Detach(m.ID); err != nil {
+						log.Println("attachRepo.Detach error:", err)
+					}
+					http.Error(w, "failed to send message", http.StatusInternalServerError)
+					return
+				}
+
+				if len(req.AttachmentIDs) > 0 {
+					atts, err := attachRepo.ListByMessages([]string{m.ID})
+					if err != nil {
+						log.Println("attachRepo.ListByMessages error:", err)
+					}
+					m.Attachments = atts[m.ID]
+				}
+
+				// ストリームで待っている双方に即配信
+				if err := pubsub.PublishJSON(broker, chatTopic(m.ProductID, m.FromUserID, m.ToUserID), "message", m); err != nil {
+					log.Println("broker.Publish error:", err)
+				}
+
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(m)
+
+			default:
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			}
+		}),
+	))
+
+	// ===== Message Attachments API =====
+	// POST /messages/attachments  multipart の "file" に画像 1 枚
+	// 返ってきた id を POST /messages の attachmentIds に入れて送る
+	mux.HandleFunc("/messages/attachments", withCORS(
+		middleware.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+
+			userID, ok := middleware.UserIDFromContext(r.Context())
+			if !ok {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			// multipart のヘッダぶん少し余裕を持たせる
+			r.Body = http.MaxBytesReader(w, r.Body, maxAttachmentSize+1<<20)
+			file, _, err := r.FormFile("file")
+			if err != nil {
+				http.Error(w, "file is required (max 5MB)", http.StatusBadRequest)
+				return
+			}
+			defer file.Close()
+
+			data, err := io.ReadAll(io.LimitReader(file, maxAttachmentSize+1))
+			if err != nil {
+				http.Error(w, "failed to read file", http.StatusBadRequest)
+				return
+			}
+			if len(data) > maxAttachmentSize {
+				http.Error(w, "file too large (max 5MB)", http.StatusRequestEntityTooLarge)
+				return
+			}
+
+			// クライアントの申告ではなく中身で判定
+			ct := http.DetectContentType(data)
+			ext, ok := attachmentTypes[ct]
+			if !ok {
+				http.Error(w, "unsupported file type (jpeg, png, gif, webp only)", http.StatusUnsupportedMediaType)
+				return
+			}
+
+			a := domain.Attachment{
+				ID:          ids.New("att"),
+				UploaderID:  userID,
+				ContentType: ct,
+				Size:        int64(len(data)),
+				CreatedAt:   time.Now().Format(time.RFC3339),
+			}
+			a.StorageKey = "attachments/" + a.ID + ext
+			a.URL = "/attachments/" + a.ID
+
+			if err := blobs.Put(a.StorageKey, bytes.NewReader(data), ct); err != nil {
+				log.Println("blobs.Put error:", err)
+				http.Error(w, "failed to store file", http.StatusInternalServerError)
+				return
+			}
+			if err := attachRepo.Create(a); err != nil {
+				log.Println("attachRepo.Create error:", err)
+				if err := blobs.Delete(a.StorageKey); err != nil {
+					log.Println("blobs.Delete error:", err)
+				}
+				http.Error(w, "failed to save attachment", http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(a)
+		}),
+	))
+
+	// GET /attachments/{id}  アップロードした本人 or そのメッセージの当事者だけ見られる
+	// <img src> から使うので token は ?token= でも可
+	mux.HandleFunc("/attachments/", withCORS(
+		middleware.RequireAuthQuery(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+
+			userID, ok := middleware.UserIDFromContext(r.Context())
+			if !ok {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			a, err := attachRepo.FindByID(strings.TrimPrefix(r.URL.Path, "/attachments/"))
+			if err != nil {
+				http.Error(w, "attachment not found", http.StatusNotFound)
+				return
+			}
+
+			allowed := a.UploaderID == userID
+			if !allowed && a.MessageID != "" {
+				m, err := msgRepo.FindByID(a.MessageID)
+				allowed = err == nil && (m.FromUserID == userID || m.ToUserID == userID)
+			}
+			if !allowed {
+				http.Error(w, "attachment not found", http.StatusNotFound)
+				return
+			}
+
+			rc, _, err := blobs.Get(a.StorageKey)
+			if err != nil {
+				log.Println("blobs.Get error:", err)
+				http.Error(w, "attachment not found", http.StatusNotFound)
+				return
+			}
+			defer rc.Close()
+
+			w.Header().Set("Content-Type", a.ContentType)
+			w.Header().Set("Content-Length", strconv.FormatInt(a.Size, 10))
+			w.Header().Set("Cache-Control", "private, max-age=86400")
+			w.Header().Set("X-Content-Type-Options", "nosniff")
+			io.Copy(w, rc)
+		}),
+	))
+
+	// ===== Read Receipts API =====
+	// POST /messages/read { productId, otherUserId, upToMessageId }
+	// 相手からのメッセージを upToMessageId まで既読に（省略時はスレッド全部）
+	mux.HandleFunc("/messages/read", withCORS(
+		middleware.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+
+			userID, ok := middleware.UserIDFromContext(r.Context())
+			if !ok {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			var req struct {
+				ProductID     string `json:"productId"`
+				OtherUserID   string `json:"otherUserId"`
+				UpToMessageID string `json:"upToMessageId"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "invalid request", http.StatusBadRequest)
+				return
+			}
+			if req.ProductID == "" || req.OtherUserID == "" {
+				http.Error(w, "productId and otherUserId are required", http.StatusBadRequest)
+				return
+			}
+
+			readAt, n, err := msgRepo.MarkRead(userID, req.OtherUserID, req.ProductID, req.UpToMessageID)
+			if err == repository.ErrMessageNotFound {
+				http.Error(w, "message not found", http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				log.Println("msgRepo.MarkRead error:", err)
+				http.Error(w, "failed to mark as read", http.StatusInternalServerError)
+				return
+			}
+
+			// 送信側の画面に既読を出す
+			if n > 0 {
+				ev := map[string]string{
+					"productId":     req.ProductID,
+					"readerId":      userID,
+					"upToMessageId": req.UpToMessageID,
+					"readAt":        readAt,
+				}
+				if err := pubsub.PublishJSON(broker, chatTopic(req.ProductID, userID, req.OtherUserID), "read", ev); err != nil {
+					log.Println("broker.Publish error:", err)
+				}
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]any{
+				"updated": n,
+				"readAt":  readAt,
+			})
+		}),
+	))
+
+	// ===== Unread API =====
+	// GET /messages/unread  自分宛ての未読数（合計 + スレッドごと）
+	mux.HandleFunc("/messages/unread", withCORS(
+		middleware.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+
+			userID, ok := middleware.UserIDFromContext(r.Context())
+			if !ok {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			counts, err := msgRepo.UnreadCounts(userID)
+			if err != nil {
+				log.Println("msgRepo.UnreadCounts error:", err)
+				http.Error(w, "failed to count unread messages", http.StatusInternalServerError)
+				return
+			}
+
+			total := 0
+			for _, c := range counts {
+				total += c.Count
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]any{
+				"total":   total,
+				"threads": counts,
+			})
+		}),
+	))
+
+	// ===== Messages Stream API (SSE) =====
+	// GET /messages/stream?productId=&otherUserId=
+	// EventSource から使うので token は ?token= でも可
+	mux.HandleFunc("/messages/stream", withCORS(
+		middleware.RequireAuthQuery(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+
+			userID, ok := middleware.UserIDFromContext(r.Context())
+			if !ok {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			other := r.URL.Query().Get("otherUserId")
+			productID := r.URL.Query().Get("productId")
+			if other == "" || productID == "" {
+				http.Error(w, "otherUserId and productId are required", http.StatusBadRequest)
+				return
+			}
+
+			flusher, ok := w.(http.Flusher)
+			if !ok {
+				http.Error(w, "streaming not supported", http.StatusInternalServerError)
+				return
+			}
+
+			events, cancel := broker.Subscribe(chatTopic(productID, userID, other))
+			defer cancel()
+
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("Connection", "keep-alive")
+			w.WriteHeader(http.StatusOK)
+			flusher.Flush()
+
+			// プロキシに切られないように定期的にコメントを送る
+			keepAlive := time.NewTicker(25 * time.Second)
+			defer keepAlive.Stop()
+
+			for {
+				select {
+				case <-r.Context().Done():
+					return
+				case <-keepAlive.C:
+					fmt.Fprint(w, ": ping\n\n")
+					flusher.Flush()
+				case ev, ok := <-events:
+					if !ok {
+						return
+					}
+					fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, ev.Data)
+					flusher.Flush()
+				}
+			}
+		}),
+	))
+
+	// ===== User API =====
+	mux.HandleFunc("/users/", withCORS(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/users/"), "/")
+		userID := parts[0]
+		if userID == "" {
+			http.Error(w, "userId required", http.StatusBadRequest)
+			return
+		}
+		if len(parts) > 2 || (len(parts) == 2 && parts[1] != "products" && parts[1] != "reviews") {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+
+		u, err := userRepo.FindByID(userID)
+		if err != nil {
+			http.Error(w, "user not found", http.StatusNotFound)
+			return
+		}
+
+		// GET /users/{id}/reviews  受け取った評価（新しい順）
+		if len(parts) == 2 && parts[1] == "reviews" {
+			reviews, err := reviewRepo.ListByReviewee(u.ID)
+			if err != nil {
+				log.Println("reviewRepo.ListByReviewee error:", err)
+				http.Error(w, "failed to list reviews", http.StatusInternalServerError)
 				return
 			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(reviews)
+			return
+		}
 
-			userID, ok := middleware.UserIDFromContext(r.Context())
-			if !ok {
-				http.Error(w, "unauthorized", http.StatusUnauthorized)
+		// GET /users/{id}/products  出品者ページ。?status= ほか GET /products と同じ条件が使える
+		if len(parts) == 2 {
+			q, err := parseProductQuery(r)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
 				return
 			}
+			q.SellerID = u.ID
+			// 本人が見るときは売れた商品の買い手も返す
+			if uid, ok := tryGetUserID(r); ok && uid == u.ID {
+				q.WithBuyer = true
+			}
 
-			u, err := userRepo.FindByID(userID)
+			products, next, err := store.List(q)
+			if err == repository.ErrInvalidCursor {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
 			if err != nil {
-				http.Error(w, "user not found", http.StatusNotFound)
+				log.Println("store.List error:", err)
+				http.Error(w, "failed to list products", http.StatusInternalServerError)
 				return
 			}
 
+			markLikedByMe(r, products)
+			attachProductImages(products)
+
+			if next != "" {
+				w.Header().Set("X-Next-Cursor", next)
+			}
 			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(map[string]string{
-				"userId":      u.ID,
-				"displayName": u.DisplayName,
-				"mbti":        u.MBTI,
-			})
-		}),
-	))
+			json.NewEncoder(w).Encode(products)
+			return
+		}
 
-	// ===== Likes API (toggle) =====
-	// POST /likes  { productId: "p_xxx" }
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(publicProfile(u))
+	}))
+
+	// POST /ai/mbti-advice
+	// ===== MBTI Advice API =====
+	// POST /ai/mbti-advice
 	// Authorization: Bearer <token>
-	// → 既にいいね済みなら Unlike、未いいねなら Like（= toggle）
-	mux.HandleFunc("/likes", withCORS(
+	mux.HandleFunc("/ai/mbti-advice", withCORS(
 		middleware.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
 			if r.Method != http.MethodPost {
 				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
@@ -241,166 +2898,266 @@ func main() {
 			}
 
 			var req struct {
-				ProductID string `json:"productId"`
+				SellerName string `json:"sellerName"`
+				SellerMBTI string `json:"sellerMbti"`
+				BuyerMBTI  string `json:"buyerMbti"`
 			}
-			if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ProductID == "" {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 				http.Error(w, "invalid request", http.StatusBadRequest)
 				return
 			}
-
-			userID, ok := middleware.UserIDFromContext(r.Context())
-			if !ok {
-				http.Error(w, "unauthorized", http.StatusUnauthorized)
+			if req.SellerName == "" || req.SellerMBTI == "" || req.BuyerMBTI == "" {
+				http.Error(w, "sellerName, sellerMbti, buyerMbti are required", http.StatusBadRequest)
 				return
 			}
 
-			liked, err := likeRepo.IsLiked(req.ProductID, userID)
-			if err != nil {
-				log.Println("likeRepo.IsLiked error:", err)
-				http.Error(w, "failed to check like", http.StatusInternalServerError)
-				return
-			}
+			prompt := fmt.Sprintf(
+				`あなたはフリマアプリのアシスタントです。
 
-			if liked {
-				if err := likeRepo.Unlike(req.ProductID, userID); err != nil {
-					log.Println("likeRepo.Unlike error:", err)
-					http.Error(w, "failed to unlike", http.StatusInternalServerError)
-					return
-				}
-			} else {
-				if err := likeRepo.Like(req.ProductID, userID); err != nil {
-					log.Println("likeRepo.Like error:", err)
-					http.Error(w, "failed to like", http.StatusInternalServerError)
-					return
-				}
-			}
+出品者と購入希望者のMBTIをもとに、
+以下を日本語でとても簡潔に説明してください。
+ただし、アスタリスクやシャープを用いたマークダウン記法での強調や見出しの追加と、箇条書きは絶対にしないでください。
 
-			cnt, err := likeRepo.CountByProduct(req.ProductID)
+出品者の性格傾向
+両者の相性
+円滑にやり取りするコツ
+
+出品者:
+名前: %s
+MBTI: %s
+
+購入者MBTI: %s
+
+注意：** ** ←このようなアスタリスクを用いた強調は絶対しないでください。
+注意：### ←このようなシャープを用いた見出しの作成は絶対しないでください。
+注意：箇条書き禁止。全て地の文で。
+注意：簡潔に書いてください。
+`,
+				req.SellerName, req.SellerMBTI, req.BuyerMBTI,
+			)
+
+			text, err := auth.GenerateText(prompt)
 			if err != nil {
-				log.Println("likeRepo.CountByProduct error:", err)
-				http.Error(w, "failed to count likes", http.StatusInternalServerError)
+				log.Println("GenerateText error:", err)
+				http.Error(w, "AI error", http.StatusInternalServerError)
 				return
 			}
 
 			w.Header().Set("Content-Type", "application/json")
-			// フロント(toggleLike)は { liked, likeCount } を期待してるのでそれに合わせる
-			json.NewEncoder(w).Encode(map[string]any{
-				"liked":     !liked,
-				"likeCount": cnt,
+			json.NewEncoder(w).Encode(map[string]string{
+				"text": text,
 			})
 		}),
 	))
 
-	// ===== Product API =====
-	mux.HandleFunc("/products", withCORS(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
+	// ===== Product Chat Users API =====
+	// 商品ごとにDMしてきたユーザー一覧（相手一覧）
+	mux.HandleFunc("/product-chats", withCORS(
+		middleware.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
 
-		switch r.Method {
-		case http.MethodGet:
-			products, err := store.List()
+			userID, ok := middleware.UserIDFromContext(r.Context())
+			if !ok {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			productID := r.URL.Query().Get("productId")
+			if productID == "" {
+				http.Error(w, "productId is required", http.StatusBadRequest)
+				return
+			}
+
+			userIDs, err := msgRepo.ListChatUsersByProduct(userID, productID)
 			if err != nil {
-				log.Println("store.List error:", err)
-				http.Error(w, "failed to list products", http.StatusInternalServerError)
+				http.Error(w, "failed to list chat users", http.StatusInternalServerError)
 				return
 			}
 
-			uid, ok := tryGetUserID(r)
+			type ChatUser struct {
+				UserID      string `json:"userId"`
+				DisplayName string `json:"displayName"`
+			}
 
-			// いいね数 + 自分がいいねしたか（tokenがあれば）
-			for i := range products {
-				c, err := likeRepo.CountByProduct(products[i].ID)
+			var res []ChatUser
+			for _, uid := range userIDs {
+				u, err := userRepo.FindByID(uid)
 				if err != nil {
-					log.Println("likeRepo.CountByProduct error:", err)
-					c = 0
+					continue
 				}
-				products[i].LikeCount = c
+				res = append(res, ChatUser{
+					UserID:      uid,
+					DisplayName: u.DisplayName,
+				})
+			}
 
-				if ok {
-					liked, err := likeRepo.IsLiked(products[i].ID, uid)
-					if err == nil {
-						products[i].LikedByMe = liked
-					}
-				}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(res)
+		}),
+	))
+
+	// ===== Inbox API =====
+	// GET /inbox  全商品ぶんの自分のスレッドを新しい順に（商品名・相手名・最新メッセージ・未読数つき）
+	mux.HandleFunc("/inbox", withCORS(
+		middleware.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
 			}
 
-			json.NewEncoder(w).Encode(products)
+			userID, ok := middleware.UserIDFromContext(r.Context())
+			if !ok {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
 
-		case http.MethodPost:
-			var p domain.Product
-			if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
-				http.Error(w, "invalid request body", http.StatusBadRequest)
+			threads, err := msgRepo.ListInbox(userID)
+			if err != nil {
+				log.Println("msgRepo.ListInbox error:", err)
+				http.Error(w, "failed to list inbox", http.StatusInternalServerError)
 				return
 			}
 
-			p.ID = "p_" + time.Now().Format("150405")
-			p.CreatedAt = time.Now().Format(time.RFC3339)
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(threads)
+		}),
+	))
+
+	// ===== Purchase API =====
+	mux.HandleFunc("/purchase", withCORS(
+		middleware.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
 
-			// status デフォルト
-			if p.Status == "" {
-				p.Status = "available"
+			var req struct {
+				ProductID     string `json:"productId"`
+				PaymentMethod string `json:"paymentMethod"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ProductID == "" {
+				http.Error(w, "invalid request", http.StatusBadRequest)
+				return
 			}
 
-			// status バリデーション（3択）
-			if p.Status != "available" && p.Status != "sold" && p.Status != "considering" {
-				http.Error(w, "invalid status", http.StatusBadRequest)
+			buyerID, ok := middleware.UserIDFromContext(r.Context())
+			if !ok {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
 				return
 			}
 
-			// considering のときは価格を 0 扱い（価格未定）
-			if p.Status == "considering" {
-				p.Price = 0
+			p, err := store.FindByID(req.ProductID)
+			if err != nil {
+				http.Error(w, "product not found", http.StatusNotFound)
+				return
+			}
+			if p.SellerID == buyerID {
+				http.Error(w, "cannot purchase your own product", http.StatusBadRequest)
+				return
+			}
+			if p.Status != "available" {
+				http.Error(w, "product not found or already sold", http.StatusBadRequest)
+				return
 			}
 
-			if err := store.Create(p); err != nil {
-				http.Error(w, "failed to create product", http.StatusInternalServerError)
+			// 承諾済みオファーで取り置き中なら、その買い手だけが合意した金額で買える
+			price := p.Price
+			reserved, err := offerRepo.ActiveReservation(p.ID, time.Now())
+			switch {
+			case err == nil && reserved.BuyerID != buyerID:
+				http.Error(w, repository.ErrProductReserved.Error(), http.StatusConflict)
+				return
+			case err == nil:
+				price = reserved.Price
+			case err != repository.ErrOfferNotFound:
+				log.Println("offerRepo.ActiveReservation error:", err)
+				http.Error(w, "failed to create order", http.StatusInternalServerError)
 				return
 			}
 
-			w.WriteHeader(http.StatusCreated)
-			json.NewEncoder(w).Encode(p)
+			now := time.Now().Format(time.RFC3339)
+			o := domain.Order{
+				ID:        ids.New("o"),
+				ProductID: p.ID,
+				BuyerID:   buyerID,
+				SellerID:  p.SellerID,
+				Price:     price,
+				Status:    domain.OrderPendingPayment,
+				CreatedAt: now,
+				UpdatedAt: now,
+			}
+			if err := orderRepo.Create(o); err != nil {
+				log.Println("orderRepo.Create error:", err)
+				http.Error(w, "failed to create order", http.StatusInternalServerError)
+				return
+			}
 
-		default:
-			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-		}
-	}))
+			// 先に決済インテントを作る。sold にするのは決済が確定してから
+			intent, err := payments.Authorize(o.ID, o.Price, req.PaymentMethod)
+			if err != nil {
+				log.Println("payments.Authorize error:", err)
+				if err := orderRepo.Transition(o.ID, domain.OrderPendingPayment, domain.OrderCancelled); err != nil {
+					log.Println("orderRepo.Transition error:", err)
+				}
+				http.Error(w, "payment provider error", http.StatusBadGateway)
+				return
+			}
+			if err := orderRepo.SetPaymentIntent(o.ID, intent.ID); err != nil {
+				log.Println("orderRepo.SetPaymentIntent error:", err)
+				http.Error(w, "failed to update order", http.StatusInternalServerError)
+				return
+			}
+			o.PaymentIntentID = intent.ID
 
-	// ===== GEMINI API =====
-	mux.HandleFunc("/ai/product-summary", withCORS(func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-			return
-		}
+			w.Header().Set("Content-Type", "application/json")
 
-		var req struct {
-			ProductID string `json:"productId"`
-		}
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ProductID == "" {
-			http.Error(w, "invalid request", http.StatusBadRequest)
-			return
-		}
+			switch intent.Status {
+			case payment.StatusDeclined:
+				if err := orderRepo.Transition(o.ID, domain.OrderPendingPayment, domain.OrderCancelled); err != nil {
+					log.Println("orderRepo.Transition error:", err)
+				}
+				http.Error(w, "payment declined", http.StatusPaymentRequired)
+				return
 
-		p, err := store.FindByID(req.ProductID)
-		if err != nil {
-			http.Error(w, "product not found", http.StatusNotFound)
-			return
-		}
+			case payment.StatusPending:
+				// 確定は webhook（fake は delay 後の通知）で行う
+				w.WriteHeader(http.StatusAccepted)
+				json.NewEncoder(w).Encode(map[string]any{
+					"status": domain.OrderPendingPayment,
+					"order":  o,
+				})
+				return
+			}
 
-		text, err := auth.GenerateProductSummary(p)
-		if err != nil {
-			log.Println("GenerateProductSummary error:", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
+			if err := confirmPayment(o); err != nil {
+				if err == repository.ErrProductSold {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				http.Error(w, "failed to confirm payment", http.StatusInternalServerError)
+				return
+			}
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{
-			"text": text,
-		})
-	}))
+			o, err = orderRepo.FindByID(o.ID)
+			if err != nil {
+				http.Error(w, "failed to load order", http.StatusInternalServerError)
+				return
+			}
 
-	// ===== Messages API =====
-	// 商品単位で会話するので query に productId 必須
-	mux.HandleFunc("/messages", withCORS(
+			json.NewEncoder(w).Encode(map[string]any{
+				"status": "sold",
+				"order":  o,
+			})
+		}),
+	))
+
+	// ===== Offers API =====
+	// GET  /offers  自分が関わるオファー。?productId= &otherUserId= でチャットのスレッド単位に絞れる
+	// POST /offers  {productId, price} 買い手が希望価格を出す
+	mux.HandleFunc("/offers", withCORS(
 		middleware.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
 			userID, ok := middleware.UserIDFromContext(r.Context())
 			if !ok {
@@ -410,53 +3167,74 @@ func main() {
 
 			switch r.Method {
 			case http.MethodGet:
-				other := r.URL.Query().Get("otherUserId")
-				productID := r.URL.Query().Get("productId")
-				if other == "" || productID == "" {
-					http.Error(w, "otherUserId and productId are required", http.StatusBadRequest)
-					return
-				}
-
-				msgs, err := msgRepo.ListConversation(userID, other, productID)
+				q := r.URL.Query()
+				offers, err := offerRepo.ListByUser(userID, q.Get("productId"), q.Get("otherUserId"))
 				if err != nil {
-					http.Error(w, "failed to list messages", http.StatusInternalServerError)
+					log.Println("offerRepo.ListByUser error:", err)
+					http.Error(w, "failed to list offers", http.StatusInternalServerError)
 					return
 				}
-
 				w.Header().Set("Content-Type", "application/json")
-				json.NewEncoder(w).Encode(msgs)
+				json.NewEncoder(w).Encode(offers)
 
 			case http.MethodPost:
 				var req struct {
-					ToUserID  string `json:"toUserId"`
 					ProductID string `json:"productId"`
-					Body      string `json:"body"`
+					Price     int    `json:"price"`
 				}
-				if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ProductID == "" {
 					http.Error(w, "invalid request", http.StatusBadRequest)
 					return
 				}
-				if req.ToUserID == "" || req.ProductID == "" || req.Body == "" {
-					http.Error(w, "toUserId, productId and body are required", http.StatusBadRequest)
+
+				p, err := store.FindByID(req.ProductID)
+				if err != nil {
+					http.Error(w, "product not found", http.StatusNotFound)
 					return
 				}
-
-				m := domain.Message{
-					ID:         "m_" + time.Now().Format("150405.000000000"),
-					ProductID:  req.ProductID,
-					FromUserID: userID,
-					ToUserID:   req.ToUserID,
-					Body:       req.Body,
-					CreatedAt:  time.Now().Format(time.RFC3339),
+				if p.SellerID == userID {
+					http.Error(w, "cannot make an offer on your own product", http.StatusBadRequest)
+					return
+				}
+				if p.Status != "available" {
+					http.Error(w, "product is not available", http.StatusConflict)
+					return
+				}
+				if req.Price < 1 || req.Price > p.Price {
+					writeFieldErrors(w, map[string]string{
+						"price": fmt.Sprintf("must be between 1 and %d", p.Price),
+					})
+					return
 				}
 
-				if err := msgRepo.Create(m); err != nil {
-					http.Error(w, "failed to send message", http.StatusInternalServerError)
+				now := time.Now()
+				o := domain.Offer{
+					ID:         ids.New("of"),
+					ProductID:  p.ID,
+					BuyerID:    userID,
+					SellerID:   p.SellerID,
+					Price:      req.Price,
+					Status:     domain.OfferPending,
+					ProposedBy: userID,
+					ExpiresAt:  now.Add(offerExpiry).Format(time.RFC3339),
+					CreatedAt:  now.Format(time.RFC3339),
+					UpdatedAt:  now.Format(time.RFC3339),
+				}
+				if err := offerRepo.Create(o); err != nil {
+					if err == repository.ErrOfferExists {
+						http.Error(w, err.Error(), http.StatusConflict)
+						return
+					}
+					log.Println("offerRepo.Create error:", err)
+					http.Error(w, "failed to create offer", http.StatusInternalServerError)
 					return
 				}
 
+				publishOffer(o, "offered", userID)
+
 				w.Header().Set("Content-Type", "application/json")
-				json.NewEncoder(w).Encode(m)
+				w.WriteHeader(http.StatusCreated)
+				json.NewEncoder(w).Encode(o)
 
 			default:
 				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
@@ -464,100 +3242,140 @@ func main() {
 		}),
 	))
 
-	// ===== User API =====
-	mux.HandleFunc("/users/", withCORS(func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodGet {
-			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-			return
-		}
+	// GET  /offers/{id}
+	// POST /offers/{id}/accept   承諾 → 取り置き（この買い手だけがこの金額で /purchase できる）
+	// POST /offers/{id}/reject   断る
+	// POST /offers/{id}/counter  {price} 金額を出し直す（相手の返答待ちに戻る）
+	// 返答できるのは今の金額を出していない側だけ
+	mux.HandleFunc("/offers/", withCORS(
+		middleware.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+			userID, ok := middleware.UserIDFromContext(r.Context())
+			if !ok {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
 
-		userID := strings.TrimPrefix(r.URL.Path, "/users/")
-		if userID == "" {
-			http.Error(w, "userId required", http.StatusBadRequest)
-			return
-		}
+			parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/offers/"), "/")
+			if parts[0] == "" || len(parts) > 2 {
+				http.Error(w, "not found", http.StatusNotFound)
+				return
+			}
 
-		u, err := userRepo.FindByID(userID)
-		if err != nil {
-			http.Error(w, "user not found", http.StatusNotFound)
-			return
-		}
+			now := time.Now()
+			o, err := offerRepo.FindByID(parts[0])
+			if err != nil || (o.BuyerID != userID && o.SellerID != userID) {
+				http.Error(w, "offer not found", http.StatusNotFound)
+				return
+			}
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{
-			"userId":      u.ID,
-			"displayName": u.DisplayName,
-			"mbti":        u.MBTI,
-		})
-	}))
+			if len(parts) == 1 {
+				if r.Method != http.MethodGet {
+					http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(o)
+				return
+			}
 
-	// POST /ai/mbti-advice
-	// ===== MBTI Advice API =====
-	// POST /ai/mbti-advice
-	// Authorization: Bearer <token>
-	mux.HandleFunc("/ai/mbti-advice", withCORS(
-		middleware.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
 			if r.Method != http.MethodPost {
 				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 				return
 			}
-
-			var req struct {
-				SellerName string `json:"sellerName"`
-				SellerMBTI string `json:"sellerMbti"`
-				BuyerMBTI  string `json:"buyerMbti"`
-			}
-			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-				http.Error(w, "invalid request", http.StatusBadRequest)
+			if o.Status != domain.OfferPending {
+				http.Error(w, "offer is "+o.Status, http.StatusConflict)
 				return
 			}
-			if req.SellerName == "" || req.SellerMBTI == "" || req.BuyerMBTI == "" {
-				http.Error(w, "sellerName, sellerMbti, buyerMbti are required", http.StatusBadRequest)
+			if o.ProposedBy == userID {
+				http.Error(w, "waiting for the other party to respond", http.StatusConflict)
 				return
 			}
 
-			prompt := fmt.Sprintf(
-				`あなたはフリマアプリのアシスタントです。
-
-出品者と購入希望者のMBTIをもとに、
-以下を日本語でとても簡潔に説明してください。
-ただし、アスタリスクやシャープを用いたマークダウン記法での強調や見出しの追加と、箇条書きは絶対にしないでください。
-
-出品者の性格傾向
-両者の相性
-円滑にやり取りするコツ
+			var action string
+			switch parts[1] {
+			case "accept":
+				p, perr := store.FindByIDIncludingDeleted(o.ProductID)
+				if perr != nil || p.Deleted || p.Status != "available" {
+					http.Error(w, "product is not available", http.StatusConflict)
+					return
+				}
+				action, err = "accepted", offerRepo.Accept(o.ID, userID, now.Add(offerReservation), now)
 
-出品者:
-名前: %s
-MBTI: %s
+			case "reject":
+				action, err = "rejected", offerRepo.Reject(o.ID, userID, now)
 
-購入者MBTI: %s
+			case "counter":
+				var req struct {
+					Price int `json:"price"`
+				}
+				if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+					http.Error(w, "invalid json", http.StatusBadRequest)
+					return
+				}
+				p, perr := store.FindByIDIncludingDeleted(o.ProductID)
+				if perr != nil || p.Deleted || p.Status != "available" {
+					http.Error(w, "product is not available", http.StatusConflict)
+					return
+				}
+				if req.Price < 1 || req.Price > p.Price {
+					writeFieldErrors(w, map[string]string{
+						"price": fmt.Sprintf("must be between 1 and %d", p.Price),
+					})
+					return
+				}
+				action, err = "countered", offerRepo.Counter(o.ID, userID, req.Price, now.Add(offerExpiry), now)
 
-注意：** ** ←このようなアスタリスクを用いた強調は絶対しないでください。
-注意：### ←このようなシャープを用いた見出しの作成は絶対しないでください。
-注意：箇条書き禁止。全て地の文で。
-注意：簡潔に書いてください。
-`,
-				req.SellerName, req.SellerMBTI, req.BuyerMBTI,
-			)
+			default:
+				http.Error(w, "not found", http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				if err == repository.ErrOfferNotPending || err == repository.ErrProductReserved {
+					http.Error(w, err.Error(), http.StatusConflict)
+					return
+				}
+				log.Println("offerRepo "+parts[1]+" error:", err)
+				http.Error(w, "failed to update offer", http.StatusInternalServerError)
+				return
+			}
 
-			text, err := auth.GenerateText(prompt)
+			o, err = offerRepo.FindByID(o.ID)
 			if err != nil {
-				log.Println("GenerateText error:", err)
-				http.Error(w, "AI error", http.StatusInternalServerError)
+				http.Error(w, "failed to load offer", http.StatusInternalServerError)
 				return
 			}
 
+			publishOffer(o, action, userID)
+
 			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(map[string]string{
-				"text": text,
-			})
+			json.NewEncoder(w).Encode(o)
 		}),
 	))
 
-	// ===== Product Chat Users API =====
-	// 商品ごとにDMしてきたユーザー一覧（相手一覧）
-	mux.HandleFunc("/product-chats", withCORS(
+	// ===== Payment Webhook =====
+	// 決済代行からの非同期通知。署名は Provider が検証する
+	mux.HandleFunc("/payments/webhook", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		ev, err := payments.VerifyWebhook(r)
+		if err != nil {
+			http.Error(w, "invalid webhook", http.StatusBadRequest)
+			return
+		}
+
+		if err := handlePaymentEvent(ev); err != nil {
+			http.Error(w, "failed to process event", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	// ===== Orders API =====
+	// GET /orders  自分が買い手 or 売り手の注文一覧
+	mux.HandleFunc("/orders", withCORS(
 		middleware.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
 			if r.Method != http.MethodGet {
 				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
@@ -570,69 +3388,176 @@ MBTI: %s
 				return
 			}
 
-			productID := r.URL.Query().Get("productId")
-			if productID == "" {
-				http.Error(w, "productId is required", http.StatusBadRequest)
+			orders, err := orderRepo.ListByUser(userID)
+			if err != nil {
+				log.Println("orderRepo.ListByUser error:", err)
+				http.Error(w, "failed to list orders", http.StatusInternalServerError)
 				return
 			}
 
-			userIDs, err := msgRepo.ListChatUsersByProduct(userID, productID)
-			if err != nil {
-				http.Error(w, "failed to list chat users", http.StatusInternalServerError)
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(orders)
+		}),
+	))
+
+	// GET  /orders/{id}
+	// POST /orders/{id}/ship     出品者: paid → shipped
+	// POST /orders/{id}/receive  購入者: shipped → received（預かり金を出品者へ解放）
+	// POST /orders/{id}/complete 出品者: received → completed
+	// POST /orders/{id}/cancel   発送前なら購入者 or 出品者
+	// POST /orders/{id}/review   受取確認後に買い手・売り手がそれぞれ 1 回だけ相手を評価
+	mux.HandleFunc("/orders/", withCORS(
+		middleware.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+			userID, ok := middleware.UserIDFromContext(r.Context())
+			if !ok {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
 				return
 			}
 
-			type ChatUser struct {
-				UserID      string `json:"userId"`
-				DisplayName string `json:"displayName"`
+			parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/orders/"), "/")
+			orderID := parts[0]
+			if orderID == "" || len(parts) > 2 {
+				http.Error(w, "not found", http.StatusNotFound)
+				return
 			}
 
-			var res []ChatUser
-			for _, uid := range userIDs {
-				u, err := userRepo.FindByID(uid)
-				if err != nil {
-					continue
-				}
-				res = append(res, ChatUser{
-					UserID:      uid,
-					DisplayName: u.DisplayName,
-				})
+			o, err := orderRepo.FindByID(orderID)
+			if err != nil {
+				http.Error(w, "order not found", http.StatusNotFound)
+				return
+			}
+			// 当事者以外には存在も見せない
+			if o.BuyerID != userID && o.SellerID != userID {
+				http.Error(w, "order not found", http.StatusNotFound)
+				return
 			}
 
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(res)
-		}),
-	))
+			if len(parts) == 1 {
+				if r.Method != http.MethodGet {
+					http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(o)
+				return
+			}
 
-	// ===== Purchase API =====
-	mux.HandleFunc("/purchase", withCORS(
-		middleware.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
 			if r.Method != http.MethodPost {
 				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 				return
 			}
 
-			var req struct {
-				ProductID string `json:"productId"`
+			if parts[1] == "review" {
+				var req struct {
+					Rating  int    `json:"rating"`
+					Comment string `json:"comment"`
+				}
+				if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+					http.Error(w, "invalid json", http.StatusBadRequest)
+					return
+				}
+
+				req.Comment = strings.TrimSpace(req.Comment)
+				errs := map[string]string{}
+				if req.Rating < 1 || req.Rating > 5 {
+					errs["rating"] = "must be between 1 and 5"
+				}
+				if utf8.RuneCountInString(req.Comment) > maxReviewCommentLen {
+					errs["comment"] = fmt.Sprintf("must be at most %d characters", maxReviewCommentLen)
+				}
+				if len(errs) > 0 {
+					writeFieldErrors(w, errs)
+					return
+				}
+
+				if !domain.CanReviewOrder(o.Status) {
+					http.Error(w, "order is not received yet", http.StatusConflict)
+					return
+				}
+
+				rv := domain.Review{
+					OrderID:      o.ID,
+					ReviewerID:   userID,
+					RevieweeID:   o.SellerID,
+					ReviewerRole: "buyer",
+					Rating:       req.Rating,
+					Comment:      req.Comment,
+					CreatedAt:    time.Now().Format(time.RFC3339),
+				}
+				if userID == o.SellerID {
+					rv.RevieweeID, rv.ReviewerRole = o.BuyerID, "seller"
+				}
+
+				if err := reviewRepo.Create(rv); err != nil {
+					if err == repository.ErrReviewExists {
+						http.Error(w, err.Error(), http.StatusConflict)
+						return
+					}
+					log.Println("reviewRepo.Create error:", err)
+					http.Error(w, "failed to save review", http.StatusInternalServerError)
+					return
+				}
+
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusCreated)
+				json.NewEncoder(w).Encode(rv)
+				return
 			}
-			if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ProductID == "" {
-				http.Error(w, "invalid request", http.StatusBadRequest)
+
+			var to string
+			var allowed bool
+			switch parts[1] {
+			case "ship":
+				to, allowed = domain.OrderShipped, userID == o.SellerID
+			case "receive":
+				to, allowed = domain.OrderReceived, userID == o.BuyerID
+			case "complete":
+				to, allowed = domain.OrderCompleted, userID == o.SellerID
+			case "cancel":
+				to, allowed = domain.OrderCancelled, true
+			default:
+				http.Error(w, "not found", http.StatusNotFound)
+				return
+			}
+			if !allowed {
+				http.Error(w, "forbidden", http.StatusForbidden)
 				return
 			}
 
-			buyerID, ok := middleware.UserIDFromContext(r.Context())
-			if !ok {
-				http.Error(w, "unauthorized", http.StatusUnauthorized)
+			// 注文の状態と預かり金の動きは 1 トランザクションで
+			now := time.Now()
+			switch to {
+			case domain.OrderShipped:
+				err = orderRepo.Ship(o.ID, now.Add(autoReleaseAfter))
+			case domain.OrderReceived:
+				// 受取確認 → 出品者へ解放
+				err = orderRepo.Receive(o.ID, now)
+			case domain.OrderCompleted:
+				err = orderRepo.Transition(o.ID, o.Status, to)
+			case domain.OrderCancelled:
+				// 決済済み（与信中）なら返金。返金できなければ取り消さない
+				err = orderRepo.Cancel(o, now, func() error {
+					return refundPayment(payments, o.PaymentIntentID)
+				})
+			}
+			if err != nil {
+				if err == repository.ErrInvalidOrderTransition {
+					http.Error(w, "cannot change order from "+o.Status+" to "+to, http.StatusConflict)
+					return
+				}
+				log.Println("order "+parts[1]+" error:", err)
+				http.Error(w, "failed to update order", http.StatusInternalServerError)
 				return
 			}
 
-			if err := store.Purchase(req.ProductID, buyerID); err != nil {
-				http.Error(w, err.Error(), http.StatusBadRequest)
+			o, err = orderRepo.FindByID(o.ID)
+			if err != nil {
+				http.Error(w, "failed to load order", http.StatusInternalServerError)
 				return
 			}
 
 			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(map[string]string{"status": "sold"})
+			json.NewEncoder(w).Encode(o)
 		}),
 	))
 
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"freemarket-backend/domain"
+	"freemarket-backend/loginguard"
+	"freemarket-backend/repository"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestCheckCurrentPasswordThrottles(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct-horse"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := domain.User{ID: "u_1", PasswordHash: string(hash)}
+
+	// 時計は止めておく（待ち時間が明けないので、枠を超えたら 429 のまま）
+	now := func() time.Time { return time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC) }
+	cfg := loginguard.DefaultConfig
+	limiter := loginguard.New(loginguard.NewMemoryStore(now), cfg, now)
+
+	var reasons []string
+	recordFailure := func(userID, ip, reason string) {
+		reasons = append(reasons, reason)
+		if reason != repository.LoginFailThrottled {
+			limiter.Fail(userID, ip)
+		}
+	}
+
+	check := func(password string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/me/password", nil)
+		r.RemoteAddr = "203.0.113.7:50000"
+		w := httptest.NewRecorder()
+		checkCurrentPassword(w, r, limiter, recordFailure, u, password)
+		return w
+	}
+
+	// 待ち時間が付くのは FreeAttempts を超えて失敗したあと。そこまでは 400（パスワード違い）
+	n := cfg.FreeAttempts + 1
+	for i := 0; i < n; i++ {
+		if w := check("wrong"); w.Code != http.StatusBadRequest {
+			t.Fatalf("attempt %d: status = %d, want 400", i+1, w.Code)
+		}
+	}
+
+	// その次は照合する前に 429。正しいパスワードでも同じ
+	for _, pw := range []string{"wrong", "correct-horse"} {
+		w := check(pw)
+		if w.Code != http.StatusTooManyRequests {
+			t.Fatalf("%q after %d failures: status = %d, want 429", pw, n, w.Code)
+		}
+		if w.Header().Get("Retry-After") == "" {
+			t.Errorf("%q: Retry-After missing", pw)
+		}
+	}
+
+	var want []string
+	for i := 0; i < n; i++ {
+		want = append(want, repository.LoginFailBadPassword)
+	}
+	want = append(want, repository.LoginFailThrottled, repository.LoginFailThrottled)
+	if len(reasons) != len(want) {
+		t.Fatalf("recorded %v, want %v", reasons, want)
+	}
+	for i := range want {
+		if reasons[i] != want[i] {
+			t.Fatalf("recorded %v, want %v", reasons, want)
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name     string
+		trust    string // TRUST_PROXY_HEADERS
+		kService string
+		xff      string
+		want     string
+	}{
+		{name: "no proxy ignores xff", xff: "198.51.100.1", want: "192.0.2.10"},
+		{name: "trust off ignores xff", trust: "false", kService: "api", xff: "198.51.100.1", want: "192.0.2.10"},
+		{name: "trust on uses last xff", trust: "true", xff: "10.0.0.1, 198.51.100.1", want: "198.51.100.1"},
+		{name: "cloud run uses last xff", kService: "api", xff: "10.0.0.1, 198.51.100.1", want: "198.51.100.1"},
+		{name: "trust on without xff", trust: "true", want: "192.0.2.10"},
+		{name: "trust on with empty last entry", trust: "true", xff: "198.51.100.1, ", want: "192.0.2.10"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TRUST_PROXY_HEADERS", tt.trust)
+			t.Setenv("K_SERVICE", tt.kService)
+
+			r := httptest.NewRequest(http.MethodPost, "/login", nil)
+			r.RemoteAddr = "192.0.2.10:40000"
+			if tt.xff != "" {
+				r.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			if got := clientIP(r); got != tt.want {
+				t.Errorf("clientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
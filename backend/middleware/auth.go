@@ -2,6 +2,8 @@ package middleware
 
 import (
 	"context"
+	"errors"
+	"log"
 	"net/http"
 	"strings"
 
@@ -10,7 +12,16 @@ import (
 
 type ctxKey string
 
-const userIDKey ctxKey = "userId"
+const (
+	userIDKey    ctxKey = "userId"
+	sessionIDKey ctxKey = "sessionId"
+)
+
+var ErrSessionRevoked = errors.New("session revoked")
+
+// セッションがまだ有効か（ログアウト済みなら false）。main で DB につなぐ
+// 未設定なら署名と期限だけで判定する
+var SessionActive func(sessionID string) (bool, error)
 
 func UserIDFromContext(ctx context.Context) (string, bool) {
 	v := ctx.Value(userIDKey)
@@ -18,6 +29,33 @@ func UserIDFromContext(ctx context.Context) (string, bool) {
 	return s, ok
 }
 
+// /logout で今のセッションを失効させる用
+func SessionIDFromContext(ctx context.Context) (string, bool) {
+	v := ctx.Value(sessionIDKey)
+	s, ok := v.(string)
+	return s, ok
+}
+
+// 署名・期限に加えて、セッションが失効していないかも見る
+func Authenticate(tokenString string) (*auth.Claims, error) {
+	claims, err := auth.VerifyToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	// sid の無い旧トークンは失効させようがないので期限切れを待つ
+	if SessionActive != nil && claims.SessionID != "" {
+		ok, err := SessionActive(claims.SessionID)
+		if err != nil {
+			log.Println("SessionActive error:", err)
+			return nil, err
+		}
+		if !ok {
+			return nil, ErrSessionRevoked
+		}
+	}
+	return claims, nil
+}
+
 func RequireAuth(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		h := r.Header.Get("Authorization")
@@ -32,13 +70,26 @@ func RequireAuth(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
-		claims, err := auth.VerifyToken(parts[1])
+		claims, err := Authenticate(parts[1])
 		if err != nil {
 			http.Error(w, "invalid token", http.StatusUnauthorized)
 			return
 		}
 
 		ctx := context.WithValue(r.Context(), userIDKey, claims.UserID)
+		ctx = context.WithValue(ctx, sessionIDKey, claims.SessionID)
 		next(w, r.WithContext(ctx))
 	}
 }
+
+// EventSource や <img> はヘッダを付けられないので、?token= でも受け付ける
+func RequireAuthQuery(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			if t := r.URL.Query().Get("token"); t != "" {
+				r.Header.Set("Authorization", "Bearer "+t)
+			}
+		}
+		RequireAuth(next)(w, r)
+	}
+}
@@ -0,0 +1,141 @@
+package payment
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"freemarket-backend/ids"
+)
+
+// ローカル開発用の支払い手段
+const (
+	FakeMethodSuccess = "fake_success" // 即時に与信OK
+	FakeMethodDecline = "fake_decline" // 与信NG
+	FakeMethodDelayed = "fake_delayed" // 一旦 pending、delay 後に与信OK を通知
+)
+
+const FakeSignatureHeader = "X-Fake-Signature"
+
+// お金を動かさない Provider。状態はメモリに持つだけ
+type FakeProvider struct {
+	mu      sync.Mutex
+	intents map[string]*Intent
+
+	secret []byte
+	delay  time.Duration
+	notify func(Event)
+}
+
+func NewFakeProvider(secret string, delay time.Duration, notify func(Event)) *FakeProvider {
+	return &FakeProvider{
+		intents: map[string]*Intent{},
+		secret:  []byte(secret),
+		delay:   delay,
+		notify:  notify,
+	}
+}
+
+func (f *FakeProvider) Authorize(orderID string, amount int, method string) (Intent, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	in := &Intent{
+		ID:      ids.New("pi_fake"),
+		OrderID: orderID,
+		Amount:  amount,
+	}
+
+	switch method {
+	case FakeMethodDecline:
+		in.Status = StatusDeclined
+	case FakeMethodDelayed:
+		in.Status = StatusPending
+		go f.confirmLater(in.ID)
+	default:
+		in.Status = StatusAuthorized
+	}
+
+	f.intents[in.ID] = in
+	return *in, nil
+}
+
+func (f *FakeProvider) confirmLater(intentID string) {
+	time.Sleep(f.delay)
+
+	f.mu.Lock()
+	in, ok := f.intents[intentID]
+	if ok && in.Status == StatusPending {
+		in.Status = StatusAuthorized
+	}
+	f.mu.Unlock()
+
+	if ok && f.notify != nil {
+		f.notify(Event{IntentID: intentID, Status: StatusAuthorized})
+	}
+}
+
+func (f *FakeProvider) Capture(intentID string) (Intent, error) {
+	return f.move(intentID, StatusAuthorized, StatusCaptured)
+}
+
+func (f *FakeProvider) Refund(intentID string) (Intent, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	in, ok := f.intents[intentID]
+	if !ok {
+		return Intent{}, ErrIntentNotFound
+	}
+	// 与信だけならそのまま取り消し扱い
+	if in.Status != StatusAuthorized && in.Status != StatusCaptured {
+		return *in, ErrInvalidState
+	}
+	in.Status = StatusRefunded
+	return *in, nil
+}
+
+func (f *FakeProvider) move(intentID, from, to string) (Intent, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	in, ok := f.intents[intentID]
+	if !ok {
+		return Intent{}, ErrIntentNotFound
+	}
+	if in.Status != from {
+		return *in, ErrInvalidState
+	}
+	in.Status = to
+	return *in, nil
+}
+
+// body の HMAC-SHA256 を X-Fake-Signature に hex で入れてもらう
+func (f *FakeProvider) VerifyWebhook(r *http.Request) (Event, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return Event{}, err
+	}
+
+	sig, err := hex.DecodeString(r.Header.Get(FakeSignatureHeader))
+	if err != nil || !hmac.Equal(sig, f.Sign(body)) {
+		return Event{}, ErrInvalidSignature
+	}
+
+	var ev Event
+	if err := json.Unmarshal(body, &ev); err != nil {
+		return Event{}, err
+	}
+	return ev, nil
+}
+
+func (f *FakeProvider) Sign(body []byte) []byte {
+	m := hmac.New(sha256.New, f.secret)
+	m.Write(body)
+	return m.Sum(nil)
+}
@@ -0,0 +1,82 @@
+package payment
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+const devWebhookSecret = "fake-webhook-secret"
+
+// 決済インテントのステータス
+const (
+	StatusPending    = "pending"    // 確認待ち（非同期で確定する）
+	StatusAuthorized = "authorized" // 与信OK、まだ売上確定していない
+	StatusCaptured   = "captured"   // 売上確定
+	StatusDeclined   = "declined"
+	StatusRefunded   = "refunded"
+)
+
+var (
+	ErrIntentNotFound   = errors.New("payment intent not found")
+	ErrInvalidState     = errors.New("payment intent is in an invalid state")
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+)
+
+type Intent struct {
+	ID      string `json:"id"`
+	OrderID string `json:"orderId"`
+	Amount  int    `json:"amount"`
+	Status  string `json:"status"`
+}
+
+// Webhook で届く決済イベント
+type Event struct {
+	IntentID string `json:"intentId"`
+	Status   string `json:"status"`
+}
+
+// 決済代行の差し替えポイント
+type Provider interface {
+	// method はクライアントが渡す支払い手段（カードトークン等）
+	Authorize(orderID string, amount int, method string) (Intent, error)
+	Capture(intentID string) (Intent, error)
+	Refund(intentID string) (Intent, error)
+	// 署名を検証してイベントを取り出す
+	VerifyWebhook(r *http.Request) (Event, error)
+}
+
+// 環境変数から Provider を作る（今は fake だけ）
+// Cloud Run 上では PAYMENT_PROVIDER と webhook の秘密鍵を明示しないと起動しない
+// （既定の秘密鍵はリポジトリに載っているので、誰でも webhook を偽造できてしまう）
+func NewProviderFromEnv(notify func(Event)) (Provider, error) {
+	onCloudRun := os.Getenv("K_SERVICE") != ""
+
+	switch os.Getenv("PAYMENT_PROVIDER") {
+	case "", "fake":
+		if onCloudRun && os.Getenv("PAYMENT_PROVIDER") == "" {
+			return nil, errors.New("PAYMENT_PROVIDER is not set")
+		}
+		secret := os.Getenv("FAKE_PAYMENT_WEBHOOK_SECRET")
+		if secret == "" {
+			if onCloudRun {
+				return nil, errors.New("FAKE_PAYMENT_WEBHOOK_SECRET is not set")
+			}
+			log.Println("⚠️ FAKE_PAYMENT_WEBHOOK_SECRET not set, using dev secret")
+			secret = devWebhookSecret
+		}
+		delay := 5 * time.Second
+		if v := os.Getenv("FAKE_PAYMENT_DELAY"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return nil, err
+			}
+			delay = d
+		}
+		return NewFakeProvider(secret, delay, notify), nil
+	default:
+		return nil, errors.New("unknown PAYMENT_PROVIDER")
+	}
+}
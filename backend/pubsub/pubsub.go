@@ -0,0 +1,77 @@
+package pubsub
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// 購読者に流すイベント。Data は JSON のまま運ぶ（インスタンス間でも同じ形で送れるように）
+type Event struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// 差し替えポイント。複数インスタンスで動かすときは Redis 等の実装を入れる
+type Broker interface {
+	Publish(topic string, ev Event) error
+	// 戻り値の cancel で購読をやめる（チャネルも閉じる）
+	Subscribe(topic string) (<-chan Event, func())
+}
+
+// 1 プロセス内だけで配る Broker
+type InProcess struct {
+	mu   sync.Mutex
+	subs map[string]map[chan Event]struct{}
+}
+
+func NewInProcess() *InProcess {
+	return &InProcess{subs: map[string]map[chan Event]struct{}{}}
+}
+
+func (b *InProcess) Publish(topic string, ev Event) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subs[topic] {
+		select {
+		case ch <- ev:
+		default:
+			// 詰まっている購読者は待たない（クライアントは再接続後に履歴を取り直す）
+		}
+	}
+	return nil
+}
+
+func (b *InProcess) Subscribe(topic string) (<-chan Event, func()) {
+	ch := make(chan Event, 16)
+
+	b.mu.Lock()
+	if b.subs[topic] == nil {
+		b.subs[topic] = map[chan Event]struct{}{}
+	}
+	b.subs[topic][ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs[topic], ch)
+			if len(b.subs[topic]) == 0 {
+				delete(b.subs, topic)
+			}
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+	return ch, cancel
+}
+
+// Data を JSON にして Publish する
+func PublishJSON(b Broker, topic, typ string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return b.Publish(topic, Event{Type: typ, Data: data})
+}
@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"freemarket-backend/domain"
+)
+
+var (
+	ErrAttachmentNotFound = errors.New("attachment not found")
+	// 他人のもの / 既に別メッセージで使ったもの
+	ErrAttachmentUnavailable = errors.New("attachment is not available")
+)
+
+type AttachmentRepository struct {
+	db *sql.DB
+}
+
+func NewAttachmentRepository(db *sql.DB) *AttachmentRepository {
+	return &AttachmentRepository{db: db}
+}
+
+// URL は保存しない（配信パスは ID から決まる）
+func attachmentURL(id string) string {
+	return "/attachments/" + id
+}
+
+func (r *AttachmentRepository) Create(a domain.Attachment) error {
+	_, err := r.db.Exec(
+		`INSERT INTO attachments (id, uploader_id, content_type, size, storage_key, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?)`,
+		a.ID, a.UploaderID, a.ContentType, a.Size, a.StorageKey, a.CreatedAt,
+	)
+	return err
+}
+
+func (r *AttachmentRepository) FindByID(id string) (domain.Attachment, error) {
+	var a domain.Attachment
+	err := r.db.QueryRow(`
+		SELECT id, uploader_id, COALESCE(message_id, ''), content_type, size, storage_key, created_at
+		FROM attachments
+		WHERE id = ?
+	`, id).Scan(&a.ID, &a.UploaderID, &a.MessageID, &a.ContentType, &a.Size, &a.StorageKey, &a.CreatedAt)
+	if err == sql.ErrNoRows {
+		return domain.Attachment{}, ErrAttachmentNotFound
+	}
+	if err != nil {
+		return domain.Attachment{}, err
+	}
+	a.URL = attachmentURL(a.ID)
+	return a, nil
+}
+
+// 未使用の自分の添付をメッセージに紐づける。1つでも使えないものがあれば何もしない
+func (r *AttachmentRepository) AttachToMessage(messageID, uploaderID string, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	args := []any{messageID, uploaderID}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	res, err := tx.Exec(`
+		UPDATE attachments SET message_id = ?
+		WHERE uploader_id = ? AND message_id IS NULL AND id IN (`+placeholders(len(ids))+`)
+	`, args...)
+	if err != nil {
+		return err
+	}
+
+	n, _ := res.RowsAffected()
+	if int(n) != len(ids) {
+		return ErrAttachmentUnavailable
+	}
+	return tx.Commit()
+}
+
+// 複数メッセージの添付を 1 クエリで（message_id → 添付）
+func (r *AttachmentRepository) ListByMessages(messageIDs []string) (map[string][]domain.Attachment, error) {
+	out := map[string][]domain.Attachment{}
+	if len(messageIDs) == 0 {
+		return out, nil
+	}
+
+	args := make([]any, 0, len(messageIDs))
+	for _, id := range messageIDs {
+		args = append(args, id)
+	}
+
+	rows, err := r.db.Query(`
+		SELECT id, uploader_id, message_id, content_type, size, storage_key, created_at
+		FROM attachments
+		WHERE message_id IN (`+placeholders(len(messageIDs))+`)
+		ORDER BY created_at ASC, id ASC
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var a domain.Attachment
+		if err := rows.Scan(&a.ID, &a.UploaderID, &a.MessageID, &a.ContentType, &a.Size, &a.StorageKey, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		a.URL = attachmentURL(a.ID)
+		out[a.MessageID] = append(out[a.MessageID], a)
+	}
+	return out, rows.Err()
+}
+
+// メッセージ保存に失敗したときに紐づけを戻す
+func (r *AttachmentRepository) Detach(messageID string) error {
+	_, err := r.db.Exec(`UPDATE attachments SET message_id = NULL WHERE message_id = ?`, messageID)
+	return err
+}
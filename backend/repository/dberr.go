@@ -0,0 +1,21 @@
+package repository
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// INSERT が主キーか UNIQUE 制約にぶつかったか（MySQL と SQLite の両方）
+func isDuplicateKey(err error) bool {
+	if err == nil {
+		return false
+	}
+	var me *mysql.MySQLError
+	if errors.As(err, &me) {
+		return me.Number == 1062 // ER_DUP_ENTRY
+	}
+	// SQLite はドライバごとにエラーの型が違うので文言で見る
+	return strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
@@ -0,0 +1,29 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestIsDuplicateKey(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"mysql dup entry", &mysql.MySQLError{Number: 1062, Message: "Duplicate entry"}, true},
+		{"mysql wrapped", fmt.Errorf("insert: %w", &mysql.MySQLError{Number: 1062}), true},
+		{"mysql other", &mysql.MySQLError{Number: 1452, Message: "Cannot add or update a child row"}, false},
+		{"sqlite unique", errors.New("constraint failed: UNIQUE constraint failed: reviews.order_id, reviews.reviewer_id (1555)"), true},
+		{"sqlite not null", errors.New("NOT NULL constraint failed: reviews.comment"), false},
+	}
+	for _, tt := range tests {
+		if got := isDuplicateKey(tt.err); got != tt.want {
+			t.Errorf("%s: isDuplicateKey = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"freemarket-backend/domain"
+)
+
+var ErrImageNotFound = errors.New("image not found")
+
+type ImageRepository struct {
+	db *sql.DB
+}
+
+func NewImageRepository(db *sql.DB) *ImageRepository {
+	return &ImageRepository{db: db}
+}
+
+func (r *ImageRepository) Create(img domain.Image) error {
+	_, err := r.db.Exec(
+		`INSERT INTO images (id, owner_id, width, height, created_at)
+		 VALUES (?, ?, ?, ?, ?)`,
+		img.ID, img.OwnerID, img.Width, img.Height, img.CreatedAt,
+	)
+	return err
+}
+
+// URL は呼び出し側で組み立てる
+func (r *ImageRepository) FindByID(id string) (domain.Image, error) {
+	var img domain.Image
+	err := r.db.QueryRow(`
+		SELECT id, owner_id, width, height, created_at
+		FROM images
+		WHERE id = ?
+	`, id).Scan(&img.ID, &img.OwnerID, &img.Width, &img.Height, &img.CreatedAt)
+	if err == sql.ErrNoRows {
+		return domain.Image{}, ErrImageNotFound
+	}
+	if err != nil {
+		return domain.Image{}, err
+	}
+	return img, nil
+}
@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"freemarket-backend/domain"
+	"time"
+)
+
+var ErrEscrowNotHeld = errors.New("escrow is not held")
+
+type LedgerRepository struct {
+	db *sql.DB
+}
+
+func NewLedgerRepository(db *sql.DB) *LedgerRepository {
+	return &LedgerRepository{db: db}
+}
+
+// 預かり（Hold）は支払い確定と同じトランザクションで OrderRepository.MarkPaid が書く
+// 発送（期限のセット）・受取確認での解放（自動解放も）・取り消しでの返金は注文の状態と一緒に
+// OrderRepository の Ship / Receive / Cancel が書く
+
+// 自動解放の期限を過ぎた預かり
+func (r *LedgerRepository) ListDue(now time.Time) ([]domain.EscrowEntry, error) {
+	rows, err := r.db.Query(`
+		SELECT order_id, buyer_id, seller_id, amount, status, held_at, release_after
+		FROM escrow_ledger
+		WHERE status = ? AND release_after IS NOT NULL AND release_after <= ?
+		ORDER BY release_after ASC
+	`, domain.EscrowHeld, now.Format(time.RFC3339))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []domain.EscrowEntry{}
+	for rows.Next() {
+		var e domain.EscrowEntry
+		if err := rows.Scan(
+			&e.OrderID, &e.BuyerID, &e.SellerID, &e.Amount,
+			&e.Status, &e.HeldAt, &e.ReleaseAfter,
+		); err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// 出品者として / 購入者としての預かり中・解放済み（・返金済み）の合計
+func (r *LedgerRepository) Balance(userID string) (domain.Balance, error) {
+	var b domain.Balance
+	err := r.db.QueryRow(`
+		SELECT
+		  COALESCE(SUM(CASE WHEN seller_id = ? AND status = ? THEN amount ELSE 0 END), 0),
+		  COALESCE(SUM(CASE WHEN seller_id = ? AND status = ? THEN amount ELSE 0 END), 0),
+		  COALESCE(SUM(CASE WHEN buyer_id = ? AND status = ? THEN amount ELSE 0 END), 0),
+		  COALESCE(SUM(CASE WHEN buyer_id = ? AND status = ? THEN amount ELSE 0 END), 0),
+		  COALESCE(SUM(CASE WHEN buyer_id = ? AND status = ? THEN amount ELSE 0 END), 0)
+		FROM escrow_ledger
+		WHERE seller_id = ? OR buyer_id = ?
+	`,
+		userID, domain.EscrowHeld,
+		userID, domain.EscrowReleased,
+		userID, domain.EscrowHeld,
+		userID, domain.EscrowReleased,
+		userID, domain.EscrowRefunded,
+		userID, userID,
+	).Scan(&b.Held, &b.Released, &b.AsBuyer.Held, &b.AsBuyer.Released, &b.AsBuyer.Refunded)
+	return b, err
+}
@@ -2,6 +2,7 @@ package repository
 
 import (
 	"database/sql"
+	"strings"
 )
 
 type LikeRepository struct {
@@ -53,3 +54,40 @@ func (r *LikeRepository) CountByProduct(productID string) (int, error) {
 	`, productID).Scan(&count)
 	return count, err
 }
+
+// 複数商品のうち userID がいいね済みのものを 1 クエリで取る
+func (r *LikeRepository) LikedByUser(productIDs []string, userID string) (map[string]bool, error) {
+	out := map[string]bool{}
+	if len(productIDs) == 0 {
+		return out, nil
+	}
+
+	args := make([]any, 0, len(productIDs)+1)
+	args = append(args, userID)
+	for _, id := range productIDs {
+		args = append(args, id)
+	}
+
+	rows, err := r.db.Query(`
+		SELECT product_id FROM likes
+		WHERE user_id = ? AND product_id IN (`+placeholders(len(productIDs))+`)
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		out[id] = true
+	}
+	return out, rows.Err()
+}
+
+// "?, ?, ?" を n 個
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
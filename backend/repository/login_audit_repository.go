@@ -0,0 +1,31 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+)
+
+// ログイン失敗の理由
+const (
+	LoginFailUnknownUser = "unknown_user"
+	LoginFailBadPassword = "bad_password"
+	LoginFailBadTOTP     = "bad_totp"  // 2 段階認証のコード違い
+	LoginFailThrottled   = "throttled" // 待ち時間 / ロック中に来た
+)
+
+// ログイン失敗の監査ログ（追記のみ）
+type LoginAuditRepository struct {
+	db *sql.DB
+}
+
+func NewLoginAuditRepository(db *sql.DB) *LoginAuditRepository {
+	return &LoginAuditRepository{db: db}
+}
+
+func (r *LoginAuditRepository) RecordFailure(userID, ip, reason string, at time.Time) error {
+	_, err := r.db.Exec(
+		`INSERT INTO login_failures (user_id, ip, reason, created_at) VALUES (?, ?, ?, ?)`,
+		userID, ip, reason, at.Format(time.RFC3339),
+	)
+	return err
+}
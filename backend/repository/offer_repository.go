@@ -0,0 +1,221 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"freemarket-backend/domain"
+	"strings"
+	"time"
+)
+
+var (
+	ErrOfferNotFound   = errors.New("offer not found")
+	ErrOfferExists     = errors.New("you already have an open offer on this product")
+	ErrOfferNotPending = errors.New("offer is no longer open")
+	ErrProductReserved = errors.New("product is reserved for another buyer")
+)
+
+type OfferRepository struct {
+	db *sql.DB
+}
+
+func NewOfferRepository(db *sql.DB) *OfferRepository {
+	return &OfferRepository{db: db}
+}
+
+const offerColumns = `id, product_id, buyer_id, seller_id, price, status, proposed_by,
+		       expires_at, COALESCE(reserved_until, ''), created_at, updated_at`
+
+// 返答期限を過ぎた pending は、ExpirePending が書き換える前でも expired として返す
+func scanOffer(s rowScanner) (domain.Offer, error) {
+	var o domain.Offer
+	err := s.Scan(
+		&o.ID, &o.ProductID, &o.BuyerID, &o.SellerID, &o.Price, &o.Status, &o.ProposedBy,
+		&o.ExpiresAt, &o.ReservedUntil, &o.CreatedAt, &o.UpdatedAt,
+	)
+	if err == nil && o.Status == domain.OfferPending && o.ExpiresAt <= time.Now().Format(time.RFC3339) {
+		o.Status = domain.OfferExpired
+	}
+	return o, err
+}
+
+// 同じ商品に返答待ちのオファーがあれば新しく出せない
+func (r *OfferRepository) Create(o domain.Offer) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var open int
+	err = tx.QueryRow(
+		`SELECT COUNT(*) FROM offers WHERE product_id = ? AND buyer_id = ? AND status = ? AND expires_at > ?`,
+		o.ProductID, o.BuyerID, domain.OfferPending, o.CreatedAt,
+	).Scan(&open)
+	if err != nil {
+		return err
+	}
+	if open > 0 {
+		return ErrOfferExists
+	}
+
+	if _, err := tx.Exec(
+		`INSERT INTO offers (id, product_id, buyer_id, seller_id, price, status, proposed_by, expires_at, created_at, updated_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		o.ID, o.ProductID, o.BuyerID, o.SellerID, o.Price, o.Status, o.ProposedBy,
+		o.ExpiresAt, o.CreatedAt, o.UpdatedAt,
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *OfferRepository) FindByID(id string) (domain.Offer, error) {
+	o, err := scanOffer(r.db.QueryRow(`SELECT `+offerColumns+` FROM offers WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return domain.Offer{}, ErrOfferNotFound
+	}
+	if err != nil {
+		return domain.Offer{}, err
+	}
+	return o, nil
+}
+
+// 自分が買い手 or 売り手のオファー（新しい順）
+// productID / otherUserID を指定するとそのチャットスレッドの分だけに絞る
+func (r *OfferRepository) ListByUser(userID, productID, otherUserID string) ([]domain.Offer, error) {
+	where := []string{"(buyer_id = ? OR seller_id = ?)"}
+	args := []any{userID, userID}
+	if productID != "" {
+		where = append(where, "product_id = ?")
+		args = append(args, productID)
+	}
+	if otherUserID != "" {
+		where = append(where, "(buyer_id = ? OR seller_id = ?)")
+		args = append(args, otherUserID, otherUserID)
+	}
+
+	rows, err := r.db.Query(`
+		SELECT `+offerColumns+`
+		FROM offers
+		WHERE `+strings.Join(where, " AND ")+`
+		ORDER BY created_at DESC, id DESC
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []domain.Offer{}
+	for rows.Next() {
+		o, err := scanOffer(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, o)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// 返答期限を過ぎた pending を expired にする（定期実行。読むときは scanOffer が期限を見る）
+func (r *OfferRepository) ExpirePending(now time.Time) (int64, error) {
+	ts := now.Format(time.RFC3339)
+	res, err := r.db.Exec(
+		`UPDATE offers SET status = ?, updated_at = ? WHERE status = ? AND expires_at <= ?`,
+		domain.OfferExpired, ts, domain.OfferPending, ts,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// 逆提案。金額と提案者を入れ替えて返答期限を延ばす
+func (r *OfferRepository) Counter(id, actorID string, price int, expiresAt, now time.Time) error {
+	return r.respond(id, actorID, now,
+		`price = ?, proposed_by = ?, expires_at = ?`,
+		price, actorID, expiresAt.Format(time.RFC3339),
+	)
+}
+
+func (r *OfferRepository) Reject(id, actorID string, now time.Time) error {
+	return r.respond(id, actorID, now, `status = ?`, domain.OfferRejected)
+}
+
+// 承諾して reservedUntil まで取り置く。同じ商品に有効な取り置きが既にあれば ErrProductReserved
+// 取り置きの確認と更新は 1 文で行う（同じ商品の別オファーを同時に承諾しても片方しか通らない）
+func (r *OfferRepository) Accept(id, actorID string, reservedUntil, now time.Time) error {
+	o, err := r.FindByID(id)
+	if err != nil {
+		return err
+	}
+
+	ts := now.Format(time.RFC3339)
+	// MySQL は更新中のテーブルを副問い合わせで直接読めないので派生テーブルを挟む
+	res, err := r.db.Exec(`
+		UPDATE offers SET status = ?, reserved_until = ?, updated_at = ?
+		WHERE id = ? AND status = ? AND proposed_by <> ? AND expires_at > ?
+		  AND NOT EXISTS (
+		    SELECT 1 FROM (
+		      SELECT id FROM offers WHERE product_id = ? AND status = ? AND reserved_until > ?
+		    ) reserved
+		  )
+	`,
+		domain.OfferAccepted, reservedUntil.Format(time.RFC3339), ts,
+		id, domain.OfferPending, actorID, ts,
+		o.ProductID, domain.OfferAccepted, ts,
+	)
+	if err != nil {
+		return err
+	}
+
+	n, _ := res.RowsAffected()
+	if n > 0 {
+		return nil
+	}
+	if _, err := r.ActiveReservation(o.ProductID, now); err == nil {
+		return ErrProductReserved
+	}
+	return ErrOfferNotPending
+}
+
+// 返答できるのは今の金額を出していない側だけ。期限内の pending のときだけ更新する
+func (r *OfferRepository) respond(id, actorID string, now time.Time, set string, args ...any) error {
+	ts := now.Format(time.RFC3339)
+	args = append(args, ts, id, domain.OfferPending, actorID, ts)
+	res, err := r.db.Exec(
+		`UPDATE offers SET `+set+`, updated_at = ?
+		 WHERE id = ? AND status = ? AND proposed_by <> ? AND expires_at > ?`,
+		args...,
+	)
+	if err != nil {
+		return err
+	}
+
+	n, _ := res.RowsAffected()
+	if n == 0 {
+		return ErrOfferNotPending
+	}
+	return nil
+}
+
+// 今その商品を取り置いている承諾済みオファー。無ければ ErrOfferNotFound
+func (r *OfferRepository) ActiveReservation(productID string, now time.Time) (domain.Offer, error) {
+	o, err := scanOffer(r.db.QueryRow(`
+		SELECT `+offerColumns+`
+		FROM offers
+		WHERE product_id = ? AND status = ? AND reserved_until > ?
+		ORDER BY reserved_until DESC
+		LIMIT 1
+	`, productID, domain.OfferAccepted, now.Format(time.RFC3339)))
+	if err == sql.ErrNoRows {
+		return domain.Offer{}, ErrOfferNotFound
+	}
+	if err != nil {
+		return domain.Offer{}, err
+	}
+	return o, nil
+}
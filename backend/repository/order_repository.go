@@ -0,0 +1,327 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"freemarket-backend/domain"
+	"time"
+)
+
+var (
+	ErrOrderNotFound          = errors.New("order not found")
+	ErrInvalidOrderTransition = errors.New("invalid order status transition")
+)
+
+type OrderRepository struct {
+	db *sql.DB
+}
+
+func NewOrderRepository(db *sql.DB) *OrderRepository {
+	return &OrderRepository{db: db}
+}
+
+const orderColumns = `id, product_id, buyer_id, seller_id, price, status, created_at, updated_at,
+		       COALESCE(payment_intent_id, '')`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanOrder(s rowScanner) (domain.Order, error) {
+	var o domain.Order
+	err := s.Scan(
+		&o.ID, &o.ProductID, &o.BuyerID, &o.SellerID,
+		&o.Price, &o.Status, &o.CreatedAt, &o.UpdatedAt,
+		&o.PaymentIntentID,
+	)
+	return o, err
+}
+
+func (r *OrderRepository) Create(o domain.Order) error {
+	_, err := r.db.Exec(
+		`INSERT INTO orders (id, product_id, buyer_id, seller_id, price, status, created_at, updated_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		o.ID, o.ProductID, o.BuyerID, o.SellerID, o.Price, o.Status, o.CreatedAt, o.UpdatedAt,
+	)
+	return err
+}
+
+func (r *OrderRepository) FindByID(id string) (domain.Order, error) {
+	o, err := scanOrder(r.db.QueryRow(`SELECT `+orderColumns+` FROM orders WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return domain.Order{}, ErrOrderNotFound
+	}
+	if err != nil {
+		return domain.Order{}, err
+	}
+	return o, nil
+}
+
+// Webhook から注文を引く
+func (r *OrderRepository) FindByPaymentIntent(intentID string) (domain.Order, error) {
+	o, err := scanOrder(r.db.QueryRow(`SELECT `+orderColumns+` FROM orders WHERE payment_intent_id = ?`, intentID))
+	if err == sql.ErrNoRows {
+		return domain.Order{}, ErrOrderNotFound
+	}
+	if err != nil {
+		return domain.Order{}, err
+	}
+	return o, nil
+}
+
+// 自分が買い手 or 売り手の注文を新しい順で取る
+func (r *OrderRepository) ListByUser(userID string) ([]domain.Order, error) {
+	rows, err := r.db.Query(`
+		SELECT `+orderColumns+`
+		FROM orders
+		WHERE buyer_id = ? OR seller_id = ?
+		ORDER BY created_at DESC
+	`, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []domain.Order{}
+	for rows.Next() {
+		o, err := scanOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, o)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (r *OrderRepository) SetPaymentIntent(orderID, intentID string) error {
+	_, err := r.db.Exec(
+		`UPDATE orders SET payment_intent_id = ?, updated_at = ? WHERE id = ?`,
+		intentID, time.Now().Format(time.RFC3339), orderID,
+	)
+	return err
+}
+
+// 状態遷移。現在の status が from のときだけ更新する（同時更新の取りこぼし防止）
+func (r *OrderRepository) Transition(id, from, to string) error {
+	if !domain.CanTransitionOrder(from, to) {
+		return ErrInvalidOrderTransition
+	}
+
+	res, err := r.db.Exec(
+		`UPDATE orders SET status = ?, updated_at = ?
+		 WHERE id = ? AND status = ?`,
+		to, time.Now().Format(time.RFC3339), id, from,
+	)
+	if err != nil {
+		return err
+	}
+
+	n, _ := res.RowsAffected()
+	if n == 0 {
+		return ErrInvalidOrderTransition
+	}
+	return nil
+}
+
+// 発送。自動解放の期限を同じトランザクションで預かりにセットする
+func (r *OrderRepository) Ship(id string, releaseAfter time.Time) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := transitionTx(tx, id, domain.OrderPaid, domain.OrderShipped); err != nil {
+		return err
+	}
+	res, err := tx.Exec(
+		`UPDATE escrow_ledger SET release_after = ?
+		 WHERE order_id = ? AND status = ?`,
+		releaseAfter.Format(time.RFC3339), id, domain.EscrowHeld,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrEscrowNotHeld
+	}
+	return tx.Commit()
+}
+
+// 受取確認。shipped → received と、預かり金の出品者への解放を 1 トランザクションで
+// 自動解放（escrow.AutoReleaser）も同じものを使うので、二重に解放されない
+func (r *OrderRepository) Receive(id string, now time.Time) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := transitionTx(tx, id, domain.OrderShipped, domain.OrderReceived); err != nil {
+		return err
+	}
+	if err := settleTx(tx, id, domain.EscrowReleased, now); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// 取り消し。預かりを返金扱いにし、paid だったら商品を出品中に戻す
+// refund は決済側の返金。失敗したら何も書かずにそのエラーを返す
+func (r *OrderRepository) Cancel(o domain.Order, now time.Time, refund func() error) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := transitionTx(tx, o.ID, o.Status, domain.OrderCancelled); err != nil {
+		return err
+	}
+
+	// 預かりがあるのは paid 以降だけ
+	if o.Status == domain.OrderPaid {
+		if err := settleTx(tx, o.ID, domain.EscrowRefunded, now); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(
+			`UPDATE products SET status = 'available', buyer_id = NULL
+			 WHERE id = ? AND status = 'sold'`,
+			o.ProductID,
+		); err != nil {
+			return err
+		}
+	}
+
+	if err := refund(); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func transitionTx(tx *sql.Tx, id, from, to string) error {
+	if !domain.CanTransitionOrder(from, to) {
+		return ErrInvalidOrderTransition
+	}
+	res, err := tx.Exec(
+		`UPDATE orders SET status = ?, updated_at = ?
+		 WHERE id = ? AND status = ?`,
+		to, time.Now().Format(time.RFC3339), id, from,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrInvalidOrderTransition
+	}
+	return nil
+}
+
+// 預かり中のものだけ解放 / 返金する
+func settleTx(tx *sql.Tx, orderID, to string, now time.Time) error {
+	res, err := tx.Exec(
+		`UPDATE escrow_ledger SET status = ?, settled_at = ?
+		 WHERE order_id = ? AND status = ?`,
+		to, now.Format(time.RFC3339), orderID, domain.EscrowHeld,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrEscrowNotHeld
+	}
+	return nil
+}
+
+// 支払い確定。商品を sold にし、注文を paid にし、代金を預かる（escrow_ledger）までを 1 トランザクションで。
+// 商品が先に売れていたら ErrProductSold（呼び出し側で返金する）
+func (r *OrderRepository) MarkPaid(o domain.Order) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().Format(time.RFC3339)
+
+	res, err := tx.Exec(
+		`UPDATE products SET status = 'sold', buyer_id = ?
+		 WHERE id = ? AND status = 'available' AND deleted_at IS NULL`,
+		o.BuyerID, o.ProductID,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrProductSold
+	}
+
+	res, err = tx.Exec(
+		`UPDATE orders SET status = ?, updated_at = ?
+		 WHERE id = ? AND status = ?`,
+		domain.OrderPaid, now, o.ID, domain.OrderPendingPayment,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrInvalidOrderTransition
+	}
+
+	if _, err := tx.Exec(
+		`INSERT INTO escrow_ledger (order_id, buyer_id, seller_id, amount, status, held_at)
+		 VALUES (?, ?, ?, ?, ?, ?)`,
+		o.ID, o.BuyerID, o.SellerID, o.Price, domain.EscrowHeld, now,
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// 自分が売った注文（新しい順）
+func (r *OrderRepository) ListSales(sellerID string) ([]domain.OrderSummary, error) {
+	return r.listSummaries("o.seller_id = ?", sellerID)
+}
+
+// 自分が買った注文（新しい順）
+func (r *OrderRepository) ListPurchases(buyerID string) ([]domain.OrderSummary, error) {
+	return r.listSummaries("o.buyer_id = ?", buyerID)
+}
+
+// 商品は論理削除されていても表示する
+func (r *OrderRepository) listSummaries(cond string, arg any) ([]domain.OrderSummary, error) {
+	rows, err := r.db.Query(`
+		SELECT o.id, o.product_id, o.buyer_id, o.seller_id, o.price, o.status, o.created_at, o.updated_at,
+		       COALESCE(o.payment_intent_id, ''),
+		       COALESCE(p.title, ''), COALESCE(p.image_url, ''), COALESCE(p.image_id, '')
+		FROM orders o
+		LEFT JOIN products p ON p.id = o.product_id
+		WHERE `+cond+`
+		ORDER BY o.created_at DESC
+	`, arg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []domain.OrderSummary{}
+	for rows.Next() {
+		var o domain.OrderSummary
+		if err := rows.Scan(
+			&o.ID, &o.ProductID, &o.BuyerID, &o.SellerID,
+			&o.Price, &o.Status, &o.CreatedAt, &o.UpdatedAt,
+			&o.PaymentIntentID,
+			&o.ProductTitle, &o.ProductImageURL, &o.ProductImageID,
+		); err != nil {
+			return nil, err
+		}
+		out = append(out, o)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
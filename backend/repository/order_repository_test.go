@@ -0,0 +1,161 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"freemarket-backend/domain"
+)
+
+var testNow = time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+// 出品中の商品を買って支払いまで済んだ（paid・預かり中）注文
+func seedPaidOrder(t *testing.T, db *sql.DB, orders *OrderRepository, id string) domain.Order {
+	t.Helper()
+	productID := "p_" + id
+	mustExec(t, db,
+		`INSERT INTO products (id, title, price, description, seller_id, status, created_at)
+		 VALUES (?, 'title', 1000, '', 'u_seller', 'available', ?)`,
+		productID, testNow.Format(time.RFC3339),
+	)
+
+	o := domain.Order{
+		ID: id, ProductID: productID, BuyerID: "u_buyer", SellerID: "u_seller",
+		Price: 1000, Status: domain.OrderPendingPayment,
+		CreatedAt: testNow.Format(time.RFC3339), UpdatedAt: testNow.Format(time.RFC3339),
+	}
+	if err := orders.Create(o); err != nil {
+		t.Fatal(err)
+	}
+	if err := orders.MarkPaid(o); err != nil {
+		t.Fatal(err)
+	}
+	o.Status = domain.OrderPaid
+	return o
+}
+
+type orderState struct {
+	order, escrow, product string
+}
+
+func stateOf(t *testing.T, db *sql.DB, o domain.Order) orderState {
+	t.Helper()
+	var s orderState
+	if err := db.QueryRow(`SELECT status FROM orders WHERE id = ?`, o.ID).Scan(&s.order); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.QueryRow(`SELECT status FROM escrow_ledger WHERE order_id = ?`, o.ID).Scan(&s.escrow); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.QueryRow(`SELECT status FROM products WHERE id = ?`, o.ProductID).Scan(&s.product); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestCancelPaidOrderRefunds(t *testing.T) {
+	refundErr := errors.New("gateway down")
+
+	tests := []struct {
+		name    string
+		refund  error
+		wantErr error
+		want    orderState
+	}{
+		{"refund ok", nil, nil, orderState{domain.OrderCancelled, domain.EscrowRefunded, "available"}},
+		// 決済の返金に失敗したら注文も預かりもそのまま
+		{"refund fails", refundErr, refundErr, orderState{domain.OrderPaid, domain.EscrowHeld, "sold"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t)
+			orders := NewOrderRepository(db)
+			o := seedPaidOrder(t, db, orders, "o_1")
+
+			refunded := 0
+			err := orders.Cancel(o, testNow, func() error {
+				refunded++
+				return tt.refund
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Cancel = %v, want %v", err, tt.wantErr)
+			}
+			if refunded != 1 {
+				t.Errorf("refund called %d times, want 1", refunded)
+			}
+			if got := stateOf(t, db, o); got != tt.want {
+				t.Errorf("state = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCancelPendingOrderHasNoEscrow(t *testing.T) {
+	db := openTestDB(t)
+	orders := NewOrderRepository(db)
+
+	o := domain.Order{
+		ID: "o_1", ProductID: "p_1", BuyerID: "u_buyer", SellerID: "u_seller",
+		Price: 1000, Status: domain.OrderPendingPayment,
+		CreatedAt: testNow.Format(time.RFC3339), UpdatedAt: testNow.Format(time.RFC3339),
+	}
+	if err := orders.Create(o); err != nil {
+		t.Fatal(err)
+	}
+	if err := orders.Cancel(o, testNow, func() error { return nil }); err != nil {
+		t.Fatalf("Cancel: %v", err)
+	}
+	if got, _ := orders.FindByID(o.ID); got.Status != domain.OrderCancelled {
+		t.Errorf("status = %s, want cancelled", got.Status)
+	}
+}
+
+func TestShipThenReceiveReleases(t *testing.T) {
+	db := openTestDB(t)
+	orders := NewOrderRepository(db)
+	o := seedPaidOrder(t, db, orders, "o_1")
+
+	releaseAfter := testNow.Add(7 * 24 * time.Hour)
+	if err := orders.Ship(o.ID, releaseAfter); err != nil {
+		t.Fatalf("Ship: %v", err)
+	}
+	var got string
+	if err := db.QueryRow(`SELECT release_after FROM escrow_ledger WHERE order_id = ?`, o.ID).Scan(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got != releaseAfter.Format(time.RFC3339) {
+		t.Errorf("release_after = %s, want %s", got, releaseAfter.Format(time.RFC3339))
+	}
+
+	if err := orders.Receive(o.ID, testNow); err != nil {
+		t.Fatalf("Receive: %v", err)
+	}
+	if got := stateOf(t, db, o); got != (orderState{domain.OrderReceived, domain.EscrowReleased, "sold"}) {
+		t.Errorf("state = %+v", got)
+	}
+
+	// 2 回目は注文の遷移で弾かれ、預かりにも触らない
+	if err := orders.Receive(o.ID, testNow); err != ErrInvalidOrderTransition {
+		t.Errorf("second Receive = %v, want ErrInvalidOrderTransition", err)
+	}
+}
+
+// 預かりが無い（もう返金済みなど）なら受取確認ごと書かない
+func TestReceiveWithoutHeldEscrowRollsBack(t *testing.T) {
+	db := openTestDB(t)
+	orders := NewOrderRepository(db)
+	o := seedPaidOrder(t, db, orders, "o_1")
+	if err := orders.Ship(o.ID, testNow); err != nil {
+		t.Fatal(err)
+	}
+	mustExec(t, db, `UPDATE escrow_ledger SET status = ? WHERE order_id = ?`, domain.EscrowRefunded, o.ID)
+
+	if err := orders.Receive(o.ID, testNow); err != ErrEscrowNotHeld {
+		t.Fatalf("Receive = %v, want ErrEscrowNotHeld", err)
+	}
+	if got := stateOf(t, db, o); got.order != domain.OrderShipped {
+		t.Errorf("order status = %s, want shipped", got.order)
+	}
+}
@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var ErrResetTokenInvalid = errors.New("invalid or expired reset token")
+
+// パスワード再設定トークン（ハッシュのみ保存、1 回限り）
+type PasswordResetRepository struct {
+	db *sql.DB
+}
+
+func NewPasswordResetRepository(db *sql.DB) *PasswordResetRepository {
+	return &PasswordResetRepository{db: db}
+}
+
+// 新しいトークンを出すと、そのユーザーの未使用トークンは無効になる
+func (r *PasswordResetRepository) Create(tokenHash, userID string, expiresAt, now time.Time) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	ts := now.Format(time.RFC3339)
+	if _, err := tx.Exec(
+		`UPDATE password_resets SET used_at = ? WHERE user_id = ? AND used_at IS NULL`,
+		ts, userID,
+	); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(
+		`INSERT INTO password_resets (token_hash, user_id, expires_at, created_at)
+		 VALUES (?, ?, ?, ?)`,
+		tokenHash, userID, expiresAt.Format(time.RFC3339), ts,
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// since 以降に発行済みか（メールの連打よけ）
+func (r *PasswordResetRepository) IssuedSince(userID string, since time.Time) (bool, error) {
+	var n int
+	err := r.db.QueryRow(
+		`SELECT COUNT(*) FROM password_resets WHERE user_id = ? AND created_at > ?`,
+		userID, since.Format(time.RFC3339),
+	).Scan(&n)
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// 期限内・未使用のトークンを使用済みにし、パスワードを入れ替えて userId を返す
+// どちらかが失敗したらトークンも使わなかったことにする
+func (r *PasswordResetRepository) Reset(tokenHash, passwordHash string, now time.Time) (string, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var userID string
+	err = tx.QueryRow(`SELECT user_id FROM password_resets WHERE token_hash = ?`, tokenHash).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return "", ErrResetTokenInvalid
+	}
+	if err != nil {
+		return "", err
+	}
+
+	ts := now.Format(time.RFC3339)
+	res, err := tx.Exec(
+		`UPDATE password_resets SET used_at = ?
+		 WHERE token_hash = ? AND used_at IS NULL AND expires_at > ?`,
+		ts, tokenHash, ts,
+	)
+	if err != nil {
+		return "", err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return "", ErrResetTokenInvalid
+	}
+
+	if _, err := tx.Exec(`UPDATE users SET password_hash = ? WHERE id = ?`, passwordHash, userID); err != nil {
+		return "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+	return userID, nil
+}
@@ -0,0 +1,228 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"freemarket-backend/domain"
+)
+
+const MaxProductImages = 10
+
+var (
+	ErrProductImageNotFound = errors.New("image is not on this product")
+	ErrProductImageExists   = errors.New("image is already on this product")
+	ErrTooManyProductImages = errors.New("too many images on this product")
+	ErrInvalidImageOrder    = errors.New("imageIds must list every image on the product exactly once")
+)
+
+type ProductImageRepository struct {
+	db *sql.DB
+}
+
+func NewProductImageRepository(db *sql.DB) *ProductImageRepository {
+	return &ProductImageRepository{db: db}
+}
+
+// 末尾に追加。最初の 1 枚ならカバーにする
+func (r *ProductImageRepository) Add(productID, imageID string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := addProductImage(tx, productID, imageID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func addProductImage(tx *sql.Tx, productID, imageID string) error {
+	var exists int
+	err := tx.QueryRow(`SELECT COUNT(*) FROM product_images WHERE product_id = ? AND image_id = ?`, productID, imageID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists > 0 {
+		return ErrProductImageExists
+	}
+
+	var count, next int
+	err = tx.QueryRow(`
+		SELECT COUNT(*), COALESCE(MAX(position) + 1, 0)
+		FROM product_images WHERE product_id = ?
+	`, productID).Scan(&count, &next)
+	if err != nil {
+		return err
+	}
+	if count >= MaxProductImages {
+		return ErrTooManyProductImages
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO product_images (product_id, image_id, position, is_cover)
+		 VALUES (?, ?, ?, ?)`,
+		productID, imageID, next, count == 0,
+	)
+	return err
+}
+
+// imageIDs の順に並べ直す（全部そろっている必要がある）
+func (r *ProductImageRepository) Reorder(productID string, imageIDs []string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var count int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM product_images WHERE product_id = ?`, productID).Scan(&count); err != nil {
+		return err
+	}
+	if count != len(imageIDs) {
+		return ErrInvalidImageOrder
+	}
+
+	seen := map[string]bool{}
+	for i, id := range imageIDs {
+		if seen[id] {
+			return ErrInvalidImageOrder
+		}
+		seen[id] = true
+
+		res, err := tx.Exec(
+			`UPDATE product_images SET position = ? WHERE product_id = ? AND image_id = ?`,
+			i, productID, id,
+		)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrInvalidImageOrder
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *ProductImageRepository) SetCover(productID, imageID string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := setProductCover(tx, productID, imageID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func setProductCover(tx *sql.Tx, productID, imageID string) error {
+	if _, err := tx.Exec(`UPDATE product_images SET is_cover = ? WHERE product_id = ?`, false, productID); err != nil {
+		return err
+	}
+	res, err := tx.Exec(
+		`UPDATE product_images SET is_cover = ? WHERE product_id = ? AND image_id = ?`,
+		true, productID, imageID,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrProductImageNotFound
+	}
+	return nil
+}
+
+// 外す。カバーを外したら先頭の画像を新しいカバーにする
+func (r *ProductImageRepository) Remove(productID, imageID string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var isCover bool
+	err = tx.QueryRow(
+		`SELECT is_cover FROM product_images WHERE product_id = ? AND image_id = ?`,
+		productID, imageID,
+	).Scan(&isCover)
+	if err == sql.ErrNoRows {
+		return ErrProductImageNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM product_images WHERE product_id = ? AND image_id = ?`, productID, imageID); err != nil {
+		return err
+	}
+
+	if isCover {
+		var first string
+		err := tx.QueryRow(`
+			SELECT image_id FROM product_images
+			WHERE product_id = ?
+			ORDER BY position ASC
+			LIMIT 1
+		`, productID).Scan(&first)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if first != "" {
+			if _, err := tx.Exec(
+				`UPDATE product_images SET is_cover = ? WHERE product_id = ? AND image_id = ?`,
+				true, productID, first,
+			); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// URL は呼び出し側で組み立てる
+func (r *ProductImageRepository) List(productID string) ([]domain.ProductImage, error) {
+	m, err := r.ListByProducts([]string{productID})
+	if err != nil {
+		return nil, err
+	}
+	if m[productID] == nil {
+		return []domain.ProductImage{}, nil
+	}
+	return m[productID], nil
+}
+
+// 複数商品の画像を 1 クエリで（product_id → 並び順の画像）
+func (r *ProductImageRepository) ListByProducts(productIDs []string) (map[string][]domain.ProductImage, error) {
+	out := map[string][]domain.ProductImage{}
+	if len(productIDs) == 0 {
+		return out, nil
+	}
+
+	args := make([]any, 0, len(productIDs))
+	for _, id := range productIDs {
+		args = append(args, id)
+	}
+
+	rows, err := r.db.Query(`
+		SELECT product_id, image_id, position, is_cover
+		FROM product_images
+		WHERE product_id IN (`+placeholders(len(productIDs))+`)
+		ORDER BY product_id, position ASC
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var productID string
+		var img domain.ProductImage
+		if err := rows.Scan(&productID, &img.ImageID, &img.Position, &img.IsCover); err != nil {
+			return nil, err
+		}
+		out[productID] = append(out[productID], img)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,142 @@
+package repository
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// 発行したクエリを数えるだけの database/sql ドライバ
+// products の一覧には catalog 件の行、likes にはいいね済み 1 件を返す
+type countingDriver struct {
+	catalog int
+	queries atomic.Int64
+}
+
+func (d *countingDriver) Open(string) (driver.Conn, error) { return &countingConn{d: d}, nil }
+
+type countingConn struct{ d *countingDriver }
+
+func (c *countingConn) Prepare(query string) (driver.Stmt, error) {
+	return &countingStmt{d: c.d, query: query}, nil
+}
+func (c *countingConn) Close() error              { return nil }
+func (c *countingConn) Begin() (driver.Tx, error) { return nil, driver.ErrSkip }
+
+type countingStmt struct {
+	d     *countingDriver
+	query string
+}
+
+func (s *countingStmt) Close() error  { return nil }
+func (s *countingStmt) NumInput() int { return -1 }
+func (s *countingStmt) Exec([]driver.Value) (driver.Result, error) {
+	s.d.queries.Add(1)
+	return driver.RowsAffected(0), nil
+}
+func (s *countingStmt) Query([]driver.Value) (driver.Rows, error) {
+	s.d.queries.Add(1)
+	if strings.Contains(s.query, "FROM products p") {
+		return &productRows{n: s.d.catalog}, nil
+	}
+	return &likedRows{}, nil
+}
+
+type productRows struct{ i, n int }
+
+func (r *productRows) Columns() []string {
+	return []string{"id", "title", "price", "description", "seller_id", "buyer_id", "status",
+		"image_url", "image_id", "created_at", "like_count"}
+}
+func (r *productRows) Close() error { return nil }
+func (r *productRows) Next(dest []driver.Value) error {
+	if r.i >= r.n {
+		return io.EOF
+	}
+	r.i++
+	copy(dest, []driver.Value{
+		fmt.Sprintf("p_%d", r.i), "title", int64(1000), "", "u_seller", "", "available",
+		"", "", "2026-10-01T12:00:00Z", int64(r.i % 7),
+	})
+	return nil
+}
+
+type likedRows struct{ done bool }
+
+func (r *likedRows) Columns() []string { return []string{"product_id"} }
+func (r *likedRows) Close() error      { return nil }
+func (r *likedRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = "p_1"
+	return nil
+}
+
+// sql.Register は同じ名前を 2 回登録できないので連番を付ける
+var driverSeq atomic.Int64
+
+func openCountingDB(tb testing.TB, catalog int) (*sql.DB, *countingDriver) {
+	tb.Helper()
+	d := &countingDriver{catalog: catalog}
+
+	name := fmt.Sprintf("counting-%d", driverSeq.Add(1))
+	sql.Register(name, d)
+
+	db, err := sql.Open(name, "")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { db.Close() })
+	return db, d
+}
+
+// GET /products と同じ流れ：一覧（いいね数込み）→ 自分のいいねをまとめて引く
+func listWithLikes(products *SQLiteProductRepository, likes *LikeRepository) error {
+	ps, _, err := products.List(ProductQuery{Sort: SortMostLiked})
+	if err != nil {
+		return err
+	}
+	ids := make([]string, len(ps))
+	for i := range ps {
+		ids[i] = ps[i].ID
+	}
+	_, err = likes.LikedByUser(ids, "u_viewer")
+	return err
+}
+
+func TestListQueryCountIsConstant(t *testing.T) {
+	for _, catalog := range []int{1, 10, 1000} {
+		db, d := openCountingDB(t, catalog)
+		if err := listWithLikes(NewSQLiteProductRepository(db), NewLikeRepository(db)); err != nil {
+			t.Fatalf("catalog %d: %v", catalog, err)
+		}
+		if got := d.queries.Load(); got != 2 {
+			t.Errorf("catalog %d: %d queries, want 2", catalog, got)
+		}
+	}
+}
+
+// 商品数を増やしても queries/op は 2 のまま
+func BenchmarkList(b *testing.B) {
+	for _, catalog := range []int{10, 100, 1000} {
+		b.Run(fmt.Sprintf("products=%d", catalog), func(b *testing.B) {
+			db, d := openCountingDB(b, catalog)
+			products, likes := NewSQLiteProductRepository(db), NewLikeRepository(db)
+
+			n := 0
+			for b.Loop() {
+				if err := listWithLikes(products, likes); err != nil {
+					b.Fatal(err)
+				}
+				n++
+			}
+			b.ReportMetric(float64(d.queries.Load())/float64(n), "queries/op")
+		})
+	}
+}
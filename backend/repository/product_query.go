@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+// GET /products の並び順
+const (
+	SortNewest    = "newest"
+	SortPriceAsc  = "price_asc"
+	SortPriceDesc = "price_desc"
+	SortMostLiked = "most_liked"
+)
+
+const (
+	DefaultProductPageSize = 30
+	MaxProductPageSize     = 100
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// 一覧の検索条件。ゼロ値の項目は絞り込まない
+type ProductQuery struct {
+	Keyword  string // title / description の部分一致
+	MinPrice *int
+	MaxPrice *int
+	Status   string
+	SellerID string
+	Sort     string
+	Cursor   string // 前ページの NextCursor
+	Limit    int
+
+	WithBuyer bool // 売れた商品の buyer_id も返す（出品者本人が自分の出品を見るときだけ）
+}
+
+// カーソルの中身（クライアントには base64 で不透明に渡す）
+// 並び順のキーと id を持っておき、続きを WHERE で絞る
+type productCursor struct {
+	Sort string `json:"s"`
+	Str  string `json:"v,omitempty"` // created_at
+	Num  int    `json:"n,omitempty"` // price / like_count
+	ID   string `json:"id"`
+}
+
+func encodeProductCursor(c productCursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeProductCursor(s, sort string) (productCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return productCursor{}, ErrInvalidCursor
+	}
+	var c productCursor
+	if err := json.Unmarshal(b, &c); err != nil || c.Sort != sort || c.ID == "" {
+		return productCursor{}, ErrInvalidCursor
+	}
+	return c, nil
+}
@@ -4,6 +4,8 @@ import "freemarket-backend/domain"
 
 type ProductRepository interface {
 	Create(p domain.Product) error
-	List() ([]domain.Product, error)
+	List(q ProductQuery) ([]domain.Product, string, error)
 	Purchase(productID, buyerID string) error
+	Update(p domain.Product) error
+	Delete(productID, sellerID string) error
 }
@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"freemarket-backend/domain"
+)
+
+var ErrQuoteRequestExists = errors.New("already requested a quote for this product")
+
+type QuoteRequestRepository struct {
+	db *sql.DB
+}
+
+func NewQuoteRequestRepository(db *sql.DB) *QuoteRequestRepository {
+	return &QuoteRequestRepository{db: db}
+}
+
+// 同じ商品に同じ人から 2 回目なら ErrQuoteRequestExists（PRIMARY KEY (product_id, requester_id) で判定）
+func (r *QuoteRequestRepository) Create(q domain.QuoteRequest) error {
+	_, err := r.db.Exec(
+		`INSERT INTO quote_requests (product_id, requester_id, message, created_at)
+		 VALUES (?, ?, ?, ?)`,
+		q.ProductID, q.RequesterID, q.Message, q.CreatedAt,
+	)
+	if isDuplicateKey(err) {
+		return ErrQuoteRequestExists
+	}
+	return err
+}
+
+// 古い順（先に頼んだ人から）
+func (r *QuoteRequestRepository) ListByProduct(productID string) ([]domain.QuoteRequest, error) {
+	rows, err := r.db.Query(`
+		SELECT product_id, requester_id, message, created_at, COALESCE(notified_at, '')
+		FROM quote_requests
+		WHERE product_id = ?
+		ORDER BY created_at ASC
+	`, productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []domain.QuoteRequest{}
+	for rows.Next() {
+		var q domain.QuoteRequest
+		if err := rows.Scan(&q.ProductID, &q.RequesterID, &q.Message, &q.CreatedAt, &q.NotifiedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, q)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (r *QuoteRequestRepository) MarkNotified(productID, requesterID, at string) error {
+	_, err := r.db.Exec(
+		`UPDATE quote_requests SET notified_at = ?
+		 WHERE product_id = ? AND requester_id = ? AND notified_at IS NULL`,
+		at, productID, requesterID,
+	)
+	return err
+}
@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"freemarket-backend/domain"
+	"testing"
+)
+
+func TestQuoteRequestCreateDuplicate(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewQuoteRequestRepository(db)
+
+	q := domain.QuoteRequest{
+		ProductID: "p_1", RequesterID: "u_1", Message: "いくらになりますか", CreatedAt: "2026-10-01T12:00:00Z",
+	}
+	if err := repo.Create(q); err != nil {
+		t.Fatalf("first Create: %v", err)
+	}
+
+	again := q
+	again.Message = "まだですか"
+	if err := repo.Create(again); err != ErrQuoteRequestExists {
+		t.Fatalf("second Create: err = %v, want ErrQuoteRequestExists", err)
+	}
+
+	// 別の人・別の商品なら入る
+	for _, other := range []domain.QuoteRequest{
+		{ProductID: "p_1", RequesterID: "u_2", Message: "", CreatedAt: "2026-10-01T12:01:00Z"},
+		{ProductID: "p_2", RequesterID: "u_1", Message: "", CreatedAt: "2026-10-01T12:02:00Z"},
+	} {
+		if err := repo.Create(other); err != nil {
+			t.Fatalf("Create(%s, %s): %v", other.ProductID, other.RequesterID, err)
+		}
+	}
+
+	got, err := repo.ListByProduct("p_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].RequesterID != "u_1" || got[0].Message != q.Message {
+		t.Errorf("requests for p_1 = %+v", got)
+	}
+}
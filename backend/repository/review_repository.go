@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"freemarket-backend/domain"
+)
+
+var ErrReviewExists = errors.New("already reviewed this order")
+
+type ReviewRepository struct {
+	db *sql.DB
+}
+
+func NewReviewRepository(db *sql.DB) *ReviewRepository {
+	return &ReviewRepository{db: db}
+}
+
+// 同じ注文を同じ人が 2 回評価したら ErrReviewExists（PRIMARY KEY (order_id, reviewer_id) で判定）
+func (r *ReviewRepository) Create(rv domain.Review) error {
+	_, err := r.db.Exec(
+		`INSERT INTO reviews (order_id, reviewer_id, reviewee_id, reviewer_role, rating, comment, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		rv.OrderID, rv.ReviewerID, rv.RevieweeID, rv.ReviewerRole, rv.Rating, rv.Comment, rv.CreatedAt,
+	)
+	if isDuplicateKey(err) {
+		return ErrReviewExists
+	}
+	return err
+}
+
+// userID が受け取った評価を新しい順に
+func (r *ReviewRepository) ListByReviewee(userID string) ([]domain.Review, error) {
+	rows, err := r.db.Query(`
+		SELECT order_id, reviewer_id, reviewee_id, reviewer_role, rating, comment, created_at
+		FROM reviews
+		WHERE reviewee_id = ?
+		ORDER BY created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []domain.Review{}
+	for rows.Next() {
+		var rv domain.Review
+		if err := rows.Scan(
+			&rv.OrderID, &rv.ReviewerID, &rv.RevieweeID, &rv.ReviewerRole,
+			&rv.Rating, &rv.Comment, &rv.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		out = append(out, rv)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// 平均評価と件数。まだ評価が無ければ rating は nil
+func (r *ReviewRepository) Summary(userID string) (*float64, int, error) {
+	var avg sql.NullFloat64
+	var count int
+	err := r.db.QueryRow(`
+		SELECT AVG(rating), COUNT(*) FROM reviews WHERE reviewee_id = ?
+	`, userID).Scan(&avg, &count)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !avg.Valid {
+		return nil, count, nil
+	}
+	return &avg.Float64, count, nil
+}
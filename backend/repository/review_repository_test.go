@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"freemarket-backend/domain"
+	"sync"
+	"testing"
+)
+
+func TestReviewCreateDuplicate(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewReviewRepository(db)
+
+	rv := domain.Review{
+		OrderID: "o_1", ReviewerID: "buyer", RevieweeID: "seller",
+		ReviewerRole: "buyer", Rating: 5, Comment: "good", CreatedAt: "2026-10-01T12:00:00Z",
+	}
+	if err := repo.Create(rv); err != nil {
+		t.Fatalf("first Create: %v", err)
+	}
+
+	again := rv
+	again.Rating = 1
+	if err := repo.Create(again); err != ErrReviewExists {
+		t.Fatalf("second Create: err = %v, want ErrReviewExists", err)
+	}
+
+	// 相手側の評価は別の行
+	other := domain.Review{
+		OrderID: "o_1", ReviewerID: "seller", RevieweeID: "buyer",
+		ReviewerRole: "seller", Rating: 4, Comment: "", CreatedAt: "2026-10-01T12:05:00Z",
+	}
+	if err := repo.Create(other); err != nil {
+		t.Fatalf("counterpart Create: %v", err)
+	}
+
+	got, err := repo.ListByReviewee("seller")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Rating != 5 {
+		t.Errorf("reviews of seller = %+v, want the first one only", got)
+	}
+}
+
+// 同時に来ても 1 件だけ入り、残りは ErrReviewExists（事前の SELECT では防げない競合）
+func TestReviewCreateConcurrent(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewReviewRepository(db)
+
+	rv := domain.Review{
+		OrderID: "o_1", ReviewerID: "buyer", RevieweeID: "seller",
+		ReviewerRole: "buyer", Rating: 5, Comment: "", CreatedAt: "2026-10-01T12:00:00Z",
+	}
+
+	const n = 8
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = repo.Create(rv)
+		}(i)
+	}
+	wg.Wait()
+
+	ok := 0
+	for _, err := range errs {
+		switch err {
+		case nil:
+			ok++
+		case ErrReviewExists:
+		default:
+			t.Errorf("Create: unexpected error %v", err)
+		}
+	}
+	if ok != 1 {
+		t.Errorf("%d creates succeeded, want 1", ok)
+	}
+}
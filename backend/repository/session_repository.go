@@ -0,0 +1,174 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"freemarket-backend/domain"
+	"time"
+)
+
+var (
+	ErrRefreshTokenInvalid = errors.New("invalid refresh token")
+	// 使用済みのトークンがもう一度来た = 漏れている。セッションごと失効させる
+	ErrRefreshTokenReused = errors.New("refresh token reused")
+)
+
+type SessionRepository struct {
+	db *sql.DB
+}
+
+func NewSessionRepository(db *sql.DB) *SessionRepository {
+	return &SessionRepository{db: db}
+}
+
+// セッションと最初のリフレッシュトークンを作る
+func (r *SessionRepository) Start(s domain.Session, tokenHash string, expiresAt time.Time) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(
+		`INSERT INTO sessions (id, user_id, created_at) VALUES (?, ?, ?)`,
+		s.ID, s.UserID, s.CreatedAt,
+	); err != nil {
+		return err
+	}
+	if err := insertRefreshToken(tx, tokenHash, s.ID, s.UserID, expiresAt, s.CreatedAt); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func insertRefreshToken(tx *sql.Tx, hash, sessionID, userID string, expiresAt time.Time, createdAt string) error {
+	_, err := tx.Exec(
+		`INSERT INTO refresh_tokens (token_hash, session_id, user_id, expires_at, created_at)
+		 VALUES (?, ?, ?, ?, ?)`,
+		hash, sessionID, userID, expiresAt.Format(time.RFC3339), createdAt,
+	)
+	return err
+}
+
+// oldHash を使用済みにして newHash を同じセッションに発行する
+// oldHash が使用済みなら、そのセッションを失効させて ErrRefreshTokenReused
+func (r *SessionRepository) Rotate(oldHash, newHash string, expiresAt, now time.Time) (domain.Session, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return domain.Session{}, err
+	}
+	defer tx.Rollback()
+
+	var s domain.Session
+	var tokenExpiresAt string
+	var usedAt, revokedAt sql.NullString
+	err = tx.QueryRow(`
+		SELECT t.session_id, t.user_id, t.expires_at, t.used_at, s.created_at, s.revoked_at
+		FROM refresh_tokens t
+		JOIN sessions s ON s.id = t.session_id
+		WHERE t.token_hash = ?
+	`, oldHash).Scan(&s.ID, &s.UserID, &tokenExpiresAt, &usedAt, &s.CreatedAt, &revokedAt)
+	if err == sql.ErrNoRows {
+		return domain.Session{}, ErrRefreshTokenInvalid
+	}
+	if err != nil {
+		return domain.Session{}, err
+	}
+	if revokedAt.Valid {
+		return domain.Session{}, ErrRefreshTokenInvalid
+	}
+
+	ts := now.Format(time.RFC3339)
+	if usedAt.Valid {
+		if err := revokeSession(tx, s.ID, ts); err != nil {
+			return domain.Session{}, err
+		}
+		if err := tx.Commit(); err != nil {
+			return domain.Session{}, err
+		}
+		return domain.Session{}, ErrRefreshTokenReused
+	}
+	if tokenExpiresAt <= ts {
+		return domain.Session{}, ErrRefreshTokenInvalid
+	}
+
+	res, err := tx.Exec(
+		`UPDATE refresh_tokens SET used_at = ? WHERE token_hash = ? AND used_at IS NULL`,
+		ts, oldHash,
+	)
+	if err != nil {
+		return domain.Session{}, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		// 同時に 2 回使われた
+		if err := revokeSession(tx, s.ID, ts); err != nil {
+			return domain.Session{}, err
+		}
+		if err := tx.Commit(); err != nil {
+			return domain.Session{}, err
+		}
+		return domain.Session{}, ErrRefreshTokenReused
+	}
+
+	if err := insertRefreshToken(tx, newHash, s.ID, s.UserID, expiresAt, ts); err != nil {
+		return domain.Session{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return domain.Session{}, err
+	}
+	return s, nil
+}
+
+func revokeSession(tx *sql.Tx, sessionID, at string) error {
+	_, err := tx.Exec(
+		`UPDATE sessions SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL`,
+		at, sessionID,
+	)
+	return err
+}
+
+// ログアウト。本人のセッションだけ失効できる
+func (r *SessionRepository) Revoke(sessionID, userID string, now time.Time) error {
+	_, err := r.db.Exec(
+		`UPDATE sessions SET revoked_at = ? WHERE id = ? AND user_id = ? AND revoked_at IS NULL`,
+		now.Format(time.RFC3339), sessionID, userID,
+	)
+	return err
+}
+
+// 全端末からログアウト
+func (r *SessionRepository) RevokeAll(userID string, now time.Time) (int64, error) {
+	res, err := r.db.Exec(
+		`UPDATE sessions SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL`,
+		now.Format(time.RFC3339), userID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// パスワード変更時。今使っているセッション以外を失効
+func (r *SessionRepository) RevokeOthers(userID, keepSessionID string, now time.Time) (int64, error) {
+	res, err := r.db.Exec(
+		`UPDATE sessions SET revoked_at = ? WHERE user_id = ? AND id <> ? AND revoked_at IS NULL`,
+		now.Format(time.RFC3339), userID, keepSessionID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// RequireAuth から毎リクエスト呼ばれる
+func (r *SessionRepository) IsActive(sessionID string) (bool, error) {
+	var n int
+	err := r.db.QueryRow(
+		`SELECT COUNT(*) FROM sessions WHERE id = ? AND revoked_at IS NULL`,
+		sessionID,
+	).Scan(&n)
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
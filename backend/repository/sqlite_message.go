@@ -2,9 +2,13 @@ package repository
 
 import (
 	"database/sql"
+	"errors"
 	"freemarket-backend/domain"
+	"time"
 )
 
+var ErrMessageNotFound = errors.New("message not found")
+
 type SQLiteMessageRepository struct {
 	db *sql.DB
 }
@@ -56,15 +60,84 @@ func (r *SQLiteMessageRepository) ListChatUsersByProduct(
 
 // 2人の会話を時系列で取る（direction両方）
 func (r *SQLiteMessageRepository) ListConversation(userID, otherUserID, productID string) ([]domain.Message, error) {
-	rows, err := r.db.Query(`
-		SELECT id, product_id, from_user_id, to_user_id, body, created_at
+	msgs, _, err := r.ListConversationPage(userID, otherUserID, productID, ConversationPage{})
+	return msgs, err
+}
+
+const (
+	DefaultMessagePageSize = 50
+	MaxMessagePageSize     = 200
+)
+
+// GET /messages のページ指定。Before / After はメッセージ ID
+// 全部ゼロ値なら今まで通りスレッド全体
+type ConversationPage struct {
+	Limit  int
+	Before string // これより古いものを新しい側から Limit 件
+	After  string // これより新しいものを古い側から Limit 件
+}
+
+// 会話を 1 ページ分、常に古い順で返す。hasMore はその方向にまだ続きがあるか
+func (r *SQLiteMessageRepository) ListConversationPage(
+	userID, otherUserID, productID string,
+	page ConversationPage,
+) ([]domain.Message, bool, error) {
+	query := `
+		SELECT id, product_id, from_user_id, to_user_id, body, created_at,
+		       COALESCE(read_at, '')
 		FROM messages
 		WHERE product_id = ?
-		  AND ((from_user_id = ? AND to_user_id = ?) OR (from_user_id = ? AND to_user_id = ?))
-		ORDER BY created_at ASC
-	`, productID, userID, otherUserID, otherUserID, userID)
+		  AND ((from_user_id = ? AND to_user_id = ?) OR (from_user_id = ? AND to_user_id = ?))`
+	args := []any{productID, userID, otherUserID, otherUserID, userID}
+
+	paged := page.Limit > 0 || page.Before != "" || page.After != ""
+	if paged {
+		if page.Limit <= 0 {
+			page.Limit = DefaultMessagePageSize
+		}
+		if page.Limit > MaxMessagePageSize {
+			page.Limit = MaxMessagePageSize
+		}
+	}
+
+	// After のときだけ古い側から読む。それ以外（Before / 最新ページ）は新しい側から読んで後で反転
+	desc := paged && page.After == ""
+
+	cursorID, op := page.Before, "<"
+	if page.After != "" {
+		cursorID, op = page.After, ">"
+	}
+	if cursorID != "" {
+		var createdAt string
+		err := r.db.QueryRow(`SELECT created_at FROM messages WHERE id = ? AND product_id = ?`, cursorID, productID).Scan(&createdAt)
+		if err == sql.ErrNoRows {
+			return nil, false, ErrMessageNotFound
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		query += `
+		  AND (created_at ` + op + ` ? OR (created_at = ? AND id ` + op + ` ?))`
+		args = append(args, createdAt, createdAt, cursorID)
+	}
+
+	if desc {
+		query += `
+		ORDER BY created_at DESC, id DESC`
+	} else {
+		query += `
+		ORDER BY created_at ASC, id ASC`
+	}
+	if paged {
+		// 1件多く取って続きの有無を見る
+		query += `
+		LIMIT ?`
+		args = append(args, page.Limit+1)
+	}
+
+	rows, err := r.db.Query(query, args...)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 	defer rows.Close()
 
@@ -78,13 +151,154 @@ func (r *SQLiteMessageRepository) ListConversation(userID, otherUserID, productI
 			&m.ToUserID,
 			&m.Body,
 			&m.CreatedAt,
+			&m.ReadAt,
 		); err != nil {
-			return nil, err
+			return nil, false, err
 		}
 		out = append(out, m)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+
+	hasMore := paged && len(out) > page.Limit
+	if hasMore {
+		out = out[:page.Limit]
+	}
+	if desc {
+		for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+			out[i], out[j] = out[j], out[i]
+		}
+	}
+	return out, hasMore, nil
+}
+
+const inboxPreviewLen = 80
+
+// 自分が参加している全スレッドを新しい順に。最新メッセージと未読数も 1 クエリで出す
+func (r *SQLiteMessageRepository) ListInbox(userID string) ([]domain.InboxThread, error) {
+	rows, err := r.db.Query(`
+		SELECT x.product_id, COALESCE(p.title, ''),
+		       x.other_user_id, COALESCE(u.display_name, ''),
+		       x.body, x.from_user_id, x.created_at, x.unread
+		FROM (
+		  SELECT m.product_id, m.body, m.from_user_id, m.created_at,
+		    CASE WHEN m.from_user_id = ? THEN m.to_user_id ELSE m.from_user_id END AS other_user_id,
+		    ROW_NUMBER() OVER (
+		      PARTITION BY m.product_id, CASE WHEN m.from_user_id = ? THEN m.to_user_id ELSE m.from_user_id END
+		      ORDER BY m.created_at DESC, m.id DESC
+		    ) AS rn,
+		    SUM(CASE WHEN m.to_user_id = ? AND m.read_at IS NULL THEN 1 ELSE 0 END) OVER (
+		      PARTITION BY m.product_id, CASE WHEN m.from_user_id = ? THEN m.to_user_id ELSE m.from_user_id END
+		    ) AS unread
+		  FROM messages m
+		  WHERE m.from_user_id = ? OR m.to_user_id = ?
+		) x
+		LEFT JOIN products p ON p.id = x.product_id
+		LEFT JOIN users u ON u.id = x.other_user_id
+		WHERE x.rn = 1
+		ORDER BY x.created_at DESC
+	`, userID, userID, userID, userID, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []domain.InboxThread{}
+	for rows.Next() {
+		var t domain.InboxThread
+		if err := rows.Scan(
+			&t.ProductID, &t.ProductTitle,
+			&t.OtherUserID, &t.OtherUserName,
+			&t.LastMessage, &t.LastFromUserID, &t.LastMessageAt, &t.UnreadCount,
+		); err != nil {
+			return nil, err
+		}
+		if rs := []rune(t.LastMessage); len(rs) > inboxPreviewLen {
+			t.LastMessage = string(rs[:inboxPreviewLen]) + "…"
+		}
+		out = append(out, t)
+	}
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
 	return out, nil
 }
+
+// otherUserID から自分宛てのメッセージを upToMessageID まで既読にする（空なら全部）
+// 既読にした時刻と件数を返す
+func (r *SQLiteMessageRepository) MarkRead(userID, otherUserID, productID, upToMessageID string) (string, int64, error) {
+	now := time.Now().Format(time.RFC3339)
+
+	query := `UPDATE messages SET read_at = ?
+		 WHERE product_id = ? AND from_user_id = ? AND to_user_id = ? AND read_at IS NULL`
+	args := []any{now, productID, otherUserID, userID}
+
+	if upToMessageID != "" {
+		var createdAt string
+		err := r.db.QueryRow(`
+			SELECT created_at FROM messages
+			WHERE id = ? AND product_id = ?
+			  AND ((from_user_id = ? AND to_user_id = ?) OR (from_user_id = ? AND to_user_id = ?))
+		`, upToMessageID, productID, userID, otherUserID, otherUserID, userID).Scan(&createdAt)
+		if err == sql.ErrNoRows {
+			return "", 0, ErrMessageNotFound
+		}
+		if err != nil {
+			return "", 0, err
+		}
+		query += ` AND (created_at < ? OR (created_at = ? AND id <= ?))`
+		args = append(args, createdAt, createdAt, upToMessageID)
+	}
+
+	res, err := r.db.Exec(query, args...)
+	if err != nil {
+		return "", 0, err
+	}
+	n, _ := res.RowsAffected()
+	return now, n, nil
+}
+
+// 自分宛ての未読をスレッドごとに数える（to_user_id, read_at の index で引く）
+func (r *SQLiteMessageRepository) UnreadCounts(userID string) ([]domain.UnreadCount, error) {
+	rows, err := r.db.Query(`
+		SELECT product_id, from_user_id, COUNT(*)
+		FROM messages
+		WHERE to_user_id = ? AND read_at IS NULL
+		GROUP BY product_id, from_user_id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []domain.UnreadCount{}
+	for rows.Next() {
+		var c domain.UnreadCount
+		if err := rows.Scan(&c.ProductID, &c.OtherUserID, &c.Count); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (r *SQLiteMessageRepository) FindByID(id string) (domain.Message, error) {
+	var m domain.Message
+	err := r.db.QueryRow(`
+		SELECT id, product_id, from_user_id, to_user_id, body, created_at,
+		       COALESCE(read_at, '')
+		FROM messages
+		WHERE id = ?
+	`, id).Scan(&m.ID, &m.ProductID, &m.FromUserID, &m.ToUserID, &m.Body, &m.CreatedAt, &m.ReadAt)
+	if err == sql.ErrNoRows {
+		return domain.Message{}, ErrMessageNotFound
+	}
+	if err != nil {
+		return domain.Message{}, err
+	}
+	return m, nil
+}
@@ -5,6 +5,15 @@ import (
 	"errors"
 	"freemarket-backend/domain"
 	"log"
+	"strings"
+	"time"
+)
+
+var (
+	ErrProductNotFound = errors.New("product not found")
+	ErrProductSold     = errors.New("product already sold")
+
+	ErrInvalidProductTransition = errors.New("invalid product status transition")
 )
 
 type SQLiteProductRepository struct {
@@ -18,8 +27,8 @@ func NewSQLiteProductRepository(db *sql.DB) *SQLiteProductRepository {
 func (r *SQLiteProductRepository) Create(p domain.Product) error {
 	_, err := r.db.Exec(
 		`INSERT INTO products (
-			id, title, price, description, seller_id, status, image_url, created_at
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			id, title, price, description, seller_id, status, image_url, image_id, created_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		p.ID,
 		p.Title,
 		p.Price,
@@ -27,6 +36,7 @@ func (r *SQLiteProductRepository) Create(p domain.Product) error {
 		p.SellerID,
 		p.Status,
 		p.ImageURL,
+		nullIfEmpty(p.ImageID),
 		p.CreatedAt,
 	)
 	if err != nil {
@@ -35,40 +45,167 @@ func (r *SQLiteProductRepository) Create(p domain.Product) error {
 	return err
 }
 
-func (r *SQLiteProductRepository) List() ([]domain.Product, error) {
-	rows, err := r.db.Query(`
-  SELECT id, title, price, description, seller_id, status,
-         COALESCE(image_url, '') as image_url,
-         created_at
-  FROM products
-`)
+// 条件・並び順・カーソルを全部 SQL に寄せて 1 ページ分だけ取る
+// 続きがあれば nextCursor に次ページのカーソルを返す。limit が無ければ DefaultProductPageSize
+func (r *SQLiteProductRepository) List(q ProductQuery) ([]domain.Product, string, error) {
+	if q.Sort == "" {
+		q.Sort = SortNewest
+	}
+	if q.Limit <= 0 {
+		q.Limit = DefaultProductPageSize
+	}
+	if q.Limit > MaxProductPageSize {
+		q.Limit = MaxProductPageSize
+	}
+
+	// 削除済みは出さない
+	where := []string{"p.deleted_at IS NULL"}
+	var args []any
+
+	if q.Keyword != "" {
+		kw := "%" + escapeLike(q.Keyword) + "%"
+		where = append(where, "(p.title LIKE ? ESCAPE '!' OR p.description LIKE ? ESCAPE '!')")
+		args = append(args, kw, kw)
+	}
+	if q.MinPrice != nil {
+		where = append(where, "p.price >= ?")
+		args = append(args, *q.MinPrice)
+	}
+	if q.MaxPrice != nil {
+		where = append(where, "p.price <= ?")
+		args = append(args, *q.MaxPrice)
+	}
+	if q.Status != "" {
+		where = append(where, "p.status = ?")
+		args = append(args, q.Status)
+	}
+	if q.SellerID != "" {
+		where = append(where, "p.seller_id = ?")
+		args = append(args, q.SellerID)
+	}
+
+	likeCount := "COALESCE(l.like_count, 0)"
+
+	var orderBy string
+	switch q.Sort {
+	case SortNewest:
+		orderBy = "p.created_at DESC, p.id DESC"
+	case SortPriceAsc:
+		orderBy = "p.price ASC, p.id ASC"
+	case SortPriceDesc:
+		orderBy = "p.price DESC, p.id DESC"
+	case SortMostLiked:
+		orderBy = likeCount + " DESC, p.id DESC"
+	default:
+		return nil, "", errors.New("invalid sort")
+	}
+
+	if q.Cursor != "" {
+		c, err := decodeProductCursor(q.Cursor, q.Sort)
+		if err != nil {
+			return nil, "", err
+		}
+		switch q.Sort {
+		case SortNewest:
+			where = append(where, "(p.created_at < ? OR (p.created_at = ? AND p.id < ?))")
+			args = append(args, c.Str, c.Str, c.ID)
+		case SortPriceAsc:
+			where = append(where, "(p.price > ? OR (p.price = ? AND p.id > ?))")
+			args = append(args, c.Num, c.Num, c.ID)
+		case SortPriceDesc:
+			where = append(where, "(p.price < ? OR (p.price = ? AND p.id < ?))")
+			args = append(args, c.Num, c.Num, c.ID)
+		case SortMostLiked:
+			where = append(where, "("+likeCount+" < ? OR ("+likeCount+" = ? AND p.id < ?))")
+			args = append(args, c.Num, c.Num, c.ID)
+		}
+	}
+
+	query := `
+  SELECT p.id, p.title, p.price, p.description, p.seller_id, COALESCE(p.buyer_id, '') as buyer_id, p.status,
+         COALESCE(p.image_url, '') as image_url,
+         COALESCE(p.image_id, '') as image_id,
+         p.created_at,
+         ` + likeCount + ` as like_count
+  FROM products p
+  LEFT JOIN (
+    SELECT product_id, COUNT(*) AS like_count FROM likes GROUP BY product_id
+  ) l ON l.product_id = p.id`
+	query += "\n  WHERE " + strings.Join(where, " AND ")
+	query += "\n  ORDER BY " + orderBy
+	// 1件多く取って次ページの有無を判定する
+	query += "\n  LIMIT ?"
+	args = append(args, q.Limit+1)
+
+	rows, err := r.db.Query(query, args...)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	defer rows.Close()
 
-	var products []domain.Product
+	products := []domain.Product{}
 	for rows.Next() {
 		var p domain.Product
+		var buyerID string
 		if err := rows.Scan(
 			&p.ID, &p.Title, &p.Price, &p.Description,
-			&p.SellerID, &p.Status, &p.ImageURL, &p.CreatedAt,
+			&p.SellerID, &buyerID, &p.Status, &p.ImageURL, &p.ImageID, &p.CreatedAt,
+			&p.LikeCount,
 		); err != nil {
-			return nil, err
+			return nil, "", err
+		}
+		if q.WithBuyer {
+			p.BuyerID = buyerID
 		}
 		products = append(products, p)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, err
+		return nil, "", err
+	}
+
+	var next string
+	if len(products) > q.Limit {
+		products = products[:q.Limit]
+		last := products[len(products)-1]
+		c := productCursor{Sort: q.Sort, ID: last.ID}
+		switch q.Sort {
+		case SortNewest:
+			c.Str = last.CreatedAt
+		case SortPriceAsc, SortPriceDesc:
+			c.Num = last.Price
+		case SortMostLiked:
+			c.Num = last.LikeCount
+		}
+		next = encodeProductCursor(c)
 	}
 
-	return products, nil
+	return products, next, nil
+}
+
+// LIKE のワイルドカードをエスケープ（ESCAPE '!'）
+func escapeLike(s string) string {
+	r := strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+	return r.Replace(s)
 }
 
+// 一覧・公開ページ・出品や購入の操作用。削除済みは見つからない扱い
 func (r *SQLiteProductRepository) FindByID(id string) (domain.Product, error) {
+	p, err := r.FindByIDIncludingDeleted(id)
+	if err != nil {
+		return domain.Product{}, err
+	}
+	if p.Deleted {
+		return domain.Product{}, sql.ErrNoRows
+	}
+	return p, nil
+}
+
+// 注文・オファー・チャットなど、削除後も取引の当事者が商品を参照する経路用
+func (r *SQLiteProductRepository) FindByIDIncludingDeleted(id string) (domain.Product, error) {
 	row := r.db.QueryRow(`
-    SELECT id, title, price, description, seller_id, status, image_url, created_at
+    SELECT id, title, price, description, seller_id, COALESCE(buyer_id, ''), status,
+           COALESCE(image_url, ''), COALESCE(image_id, ''), created_at, deleted_at IS NOT NULL
     FROM products
     WHERE id = ?
   `, id)
@@ -76,7 +213,7 @@ func (r *SQLiteProductRepository) FindByID(id string) (domain.Product, error) {
 	var p domain.Product
 	err := row.Scan(
 		&p.ID, &p.Title, &p.Price, &p.Description,
-		&p.SellerID, &p.Status, &p.ImageURL, &p.CreatedAt,
+		&p.SellerID, &p.BuyerID, &p.Status, &p.ImageURL, &p.ImageID, &p.CreatedAt, &p.Deleted,
 	)
 	if err != nil {
 		return domain.Product{}, err // sql.ErrNoRows もここで返る
@@ -86,9 +223,9 @@ func (r *SQLiteProductRepository) FindByID(id string) (domain.Product, error) {
 
 func (r *SQLiteProductRepository) Purchase(productID, buyerID string) error {
 	res, err := r.db.Exec(
-		`UPDATE products SET status = 'sold'
-		 WHERE id = ? AND status = 'available'`,
-		productID,
+		`UPDATE products SET status = 'sold', buyer_id = ?
+		 WHERE id = ? AND status = 'available' AND deleted_at IS NULL`,
+		buyerID, productID,
 	)
 	if err != nil {
 		return err
@@ -100,3 +237,100 @@ func (r *SQLiteProductRepository) Purchase(productID, buyerID string) error {
 	}
 	return nil
 }
+
+// 取引キャンセル時の sold → available は OrderRepository.Cancel が注文と一緒に戻す
+
+// 出品者本人の、まだ売れていない商品だけ更新できる
+// 画像一覧も同じトランザクションでカバーに合わせる（image_id が空なら全部外す）
+func (r *SQLiteProductRepository) Update(p domain.Product) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(
+		`UPDATE products SET title = ?, price = ?, description = ?, image_url = ?, image_id = ?
+		 WHERE id = ? AND seller_id = ? AND status <> 'sold' AND deleted_at IS NULL`,
+		p.Title, p.Price, p.Description, p.ImageURL, nullIfEmpty(p.ImageID),
+		p.ID, p.SellerID,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrProductNotFound
+	}
+
+	if p.ImageID == "" {
+		if _, err := tx.Exec(`DELETE FROM product_images WHERE product_id = ?`, p.ID); err != nil {
+			return err
+		}
+	} else {
+		if err := addProductImage(tx, p.ID, p.ImageID); err != nil && err != ErrProductImageExists {
+			return err
+		}
+		if err := setProductCover(tx, p.ID, p.ImageID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// 出品者によるステータス切り替え（considering ⇄ available）。価格も同時に入れ替える
+// 今の status が from のときだけ更新する
+func (r *SQLiteProductRepository) Transition(productID, sellerID, from, to string, price int) error {
+	if !domain.CanTransitionProduct(from, to) {
+		return ErrInvalidProductTransition
+	}
+
+	res, err := r.db.Exec(
+		`UPDATE products SET status = ?, price = ?
+		 WHERE id = ? AND seller_id = ? AND status = ? AND deleted_at IS NULL`,
+		to, price, productID, sellerID, from,
+	)
+	if err != nil {
+		return err
+	}
+
+	n, _ := res.RowsAffected()
+	if n == 0 {
+		return ErrInvalidProductTransition
+	}
+	return nil
+}
+
+// 論理削除。messages / orders からの参照は生かしたまま一覧・購入対象から外す
+func (r *SQLiteProductRepository) Delete(productID, sellerID string) error {
+	res, err := r.db.Exec(
+		`UPDATE products SET deleted_at = ?
+		 WHERE id = ? AND seller_id = ? AND deleted_at IS NULL`,
+		time.Now().Format(time.RFC3339), productID, sellerID,
+	)
+	if err != nil {
+		return err
+	}
+
+	n, _ := res.RowsAffected()
+	if n == 0 {
+		return ErrProductNotFound
+	}
+	return nil
+}
+
+func nullIfEmpty(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// カバー画像が変わったら products 側の image_id も合わせる（互換用）
+// URL は返すときに id から作るので image_url は空にする
+func (r *SQLiteProductRepository) SetCoverImage(productID, imageID string) error {
+	_, err := r.db.Exec(
+		`UPDATE products SET image_id = ?, image_url = '' WHERE id = ?`,
+		nullIfEmpty(imageID), productID,
+	)
+	return err
+}
@@ -0,0 +1,46 @@
+package repository
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// limit が無くても 1 ページ分だけ返し、カーソルで最後まで辿れる
+func TestListDefaultPageSize(t *testing.T) {
+	db := openTestDB(t)
+	products := NewSQLiteProductRepository(db)
+
+	const total = DefaultProductPageSize + 5
+	for i := 0; i < total; i++ {
+		mustExec(t, db,
+			`INSERT INTO products (id, title, price, description, seller_id, status, created_at)
+			 VALUES (?, 'title', 1000, '', 'u_seller', 'available', ?)`,
+			fmt.Sprintf("p_%03d", i), testNow.Add(time.Duration(i)*time.Minute).Format(time.RFC3339),
+		)
+	}
+
+	first, next, err := products.List(ProductQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first) != DefaultProductPageSize || next == "" {
+		t.Fatalf("first page: %d products, next=%q; want %d and a cursor", len(first), next, DefaultProductPageSize)
+	}
+
+	rest, next, err := products.List(ProductQuery{Cursor: next})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rest) != total-DefaultProductPageSize || next != "" {
+		t.Fatalf("second page: %d products, next=%q; want %d and no cursor", len(rest), next, total-DefaultProductPageSize)
+	}
+
+	seen := map[string]bool{}
+	for _, p := range append(first, rest...) {
+		if seen[p.ID] {
+			t.Errorf("%s returned twice", p.ID)
+		}
+		seen[p.ID] = true
+	}
+}
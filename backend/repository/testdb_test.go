@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"database/sql"
+	"os"
+	"strings"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+// migrate.sql より前からあるテーブル（本番では手で作ってある）
+const baseSchema = `
+CREATE TABLE products (
+  id TEXT PRIMARY KEY,
+  title TEXT NOT NULL,
+  price INTEGER NOT NULL,
+  description TEXT NOT NULL,
+  seller_id TEXT NOT NULL,
+  status TEXT NOT NULL,
+  image_url TEXT,
+  created_at TEXT NOT NULL
+);
+CREATE TABLE messages (
+  id TEXT PRIMARY KEY,
+  product_id TEXT NOT NULL,
+  from_user_id TEXT NOT NULL,
+  to_user_id TEXT NOT NULL,
+  body TEXT NOT NULL,
+  created_at TEXT NOT NULL
+);
+CREATE TABLE likes (
+  user_id TEXT NOT NULL,
+  product_id TEXT NOT NULL,
+  created_at TEXT NOT NULL,
+  PRIMARY KEY (user_id, product_id)
+);
+CREATE TABLE users (
+  id TEXT PRIMARY KEY,
+  password_hash TEXT NOT NULL,
+  display_name TEXT NOT NULL DEFAULT '',
+  mbti TEXT NOT NULL DEFAULT '',
+  created_at TEXT NOT NULL
+);
+`
+
+// メモリ上の SQLite に db/migrate.sql まで流した DB
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// :memory: は接続ごとに別の DB になるので 1 本に絞る
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	migrate, err := os.ReadFile("../db/migrate.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range strings.Split(baseSchema+string(migrate), ";") {
+		if strings.TrimSpace(stmt) == "" {
+			continue
+		}
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("schema: %v\n%s", err, stmt)
+		}
+	}
+	return db
+}
+
+func mustExec(t *testing.T, db *sql.DB, query string, args ...any) {
+	t.Helper()
+	if _, err := db.Exec(query, args...); err != nil {
+		t.Fatalf("%v\n%s", err, query)
+	}
+}
@@ -0,0 +1,176 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"freemarket-backend/domain"
+	"time"
+)
+
+var (
+	ErrTOTPNotFound       = errors.New("two-factor authentication is not set up")
+	ErrTOTPAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrTOTPCodeUsed       = errors.New("code already used")
+)
+
+type TOTPRepository struct {
+	db *sql.DB
+}
+
+func NewTOTPRepository(db *sql.DB) *TOTPRepository {
+	return &TOTPRepository{db: db}
+}
+
+// 登録を始める（やり直しなら未確認のシークレットを差し替える）
+func (r *TOTPRepository) Begin(t domain.TOTP) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var confirmed int
+	err = tx.QueryRow(
+		`SELECT COUNT(*) FROM user_totp WHERE user_id = ? AND confirmed_at IS NOT NULL`,
+		t.UserID,
+	).Scan(&confirmed)
+	if err != nil {
+		return err
+	}
+	if confirmed > 0 {
+		return ErrTOTPAlreadyEnabled
+	}
+
+	if _, err := tx.Exec(`DELETE FROM user_totp WHERE user_id = ?`, t.UserID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(
+		`INSERT INTO user_totp (user_id, secret, last_step, created_at) VALUES (?, ?, 0, ?)`,
+		t.UserID, t.Secret, t.CreatedAt,
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *TOTPRepository) Find(userID string) (domain.TOTP, error) {
+	var t domain.TOTP
+	err := r.db.QueryRow(`
+		SELECT user_id, secret, COALESCE(confirmed_at, ''), last_step, created_at
+		FROM user_totp WHERE user_id = ?
+	`, userID).Scan(&t.UserID, &t.Secret, &t.ConfirmedAt, &t.LastStep, &t.CreatedAt)
+	if err == sql.ErrNoRows {
+		return domain.TOTP{}, ErrTOTPNotFound
+	}
+	if err != nil {
+		return domain.TOTP{}, err
+	}
+	return t, nil
+}
+
+// 有効化してリカバリーコード（ハッシュ）を入れ替える
+func (r *TOTPRepository) Confirm(userID string, step int64, codeHashes []string, now time.Time) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	ts := now.Format(time.RFC3339)
+	res, err := tx.Exec(
+		`UPDATE user_totp SET confirmed_at = ?, last_step = ?
+		 WHERE user_id = ? AND confirmed_at IS NULL`,
+		ts, step, userID,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrTOTPAlreadyEnabled
+	}
+
+	if _, err := tx.Exec(`DELETE FROM recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	for _, h := range codeHashes {
+		if _, err := tx.Exec(
+			`INSERT INTO recovery_codes (user_id, code_hash, created_at) VALUES (?, ?, ?)`,
+			userID, h, ts,
+		); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// step が前回より新しいときだけ記録する。同じ（か古い）ステップなら ErrTOTPCodeUsed
+func (r *TOTPRepository) UseStep(userID string, step int64) error {
+	res, err := r.db.Exec(
+		`UPDATE user_totp SET last_step = ? WHERE user_id = ? AND last_step < ?`,
+		step, userID, step,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrTOTPCodeUsed
+	}
+	return nil
+}
+
+// 未使用のリカバリーコードのハッシュ
+func (r *TOTPRepository) UnusedRecoveryCodes(userID string) ([]string, error) {
+	rows, err := r.db.Query(
+		`SELECT code_hash FROM recovery_codes WHERE user_id = ? AND used_at IS NULL`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []string{}
+	for rows.Next() {
+		var h string
+		if err := rows.Scan(&h); err != nil {
+			return nil, err
+		}
+		out = append(out, h)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// 使い捨てなので未使用のときだけ通す
+func (r *TOTPRepository) UseRecoveryCode(userID, codeHash string, now time.Time) error {
+	res, err := r.db.Exec(
+		`UPDATE recovery_codes SET used_at = ?
+		 WHERE user_id = ? AND code_hash = ? AND used_at IS NULL`,
+		now.Format(time.RFC3339), userID, codeHash,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrTOTPCodeUsed
+	}
+	return nil
+}
+
+func (r *TOTPRepository) Disable(userID string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM user_totp WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -2,9 +2,12 @@ package repository
 
 import (
 	"database/sql"
+	"errors"
 	"freemarket-backend/domain"
 )
 
+var ErrUserNotFound = errors.New("user not found")
+
 type UserRepository struct {
 	db *sql.DB
 }
@@ -15,33 +18,60 @@ func NewUserRepository(db *sql.DB) *UserRepository {
 
 func (r *UserRepository) Create(u domain.User) error {
 	_, err := r.db.Exec(
-		`INSERT INTO users (id, password_hash, display_name, mbti, created_at)
-		 VALUES (?, ?, ?, ?, ?)`,
+		`INSERT INTO users (id, password_hash, display_name, mbti, email, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?)`,
 		u.ID,
 		u.PasswordHash,
 		u.DisplayName,
 		u.MBTI,
+		nullIfEmpty(u.Email),
 		u.CreatedAt,
 	)
 	return err
 }
 
-func (r *UserRepository) FindByID(id string) (domain.User, error) {
-
-	row := r.db.QueryRow(`
-		SELECT
-			id,
-			password_hash,
-			COALESCE(display_name, ''),
-			COALESCE(mbti, ''),
-			created_at
-		FROM users
-		WHERE id = ?
-	`, id)
+const userColumns = `id, password_hash, COALESCE(display_name, ''), COALESCE(mbti, ''),
+			COALESCE(email, ''), created_at`
 
+func scanUser(s rowScanner) (domain.User, error) {
 	var u domain.User
-	if err := row.Scan(&u.ID, &u.PasswordHash, &u.DisplayName, &u.MBTI, &u.CreatedAt); err != nil {
+	err := s.Scan(&u.ID, &u.PasswordHash, &u.DisplayName, &u.MBTI, &u.Email, &u.CreatedAt)
+	return u, err
+}
+
+func (r *UserRepository) FindByID(id string) (domain.User, error) {
+	u, err := scanUser(r.db.QueryRow(`SELECT `+userColumns+` FROM users WHERE id = ?`, id))
+	if err != nil {
 		return domain.User{}, err
 	}
 	return u, nil
 }
+
+// パスワード再設定の依頼をメールアドレスで受けるとき用
+func (r *UserRepository) FindByEmail(email string) (domain.User, error) {
+	u, err := scanUser(r.db.QueryRow(`SELECT `+userColumns+` FROM users WHERE email = ?`, email))
+	if err == sql.ErrNoRows {
+		return domain.User{}, ErrUserNotFound
+	}
+	if err != nil {
+		return domain.User{}, err
+	}
+	return u, nil
+}
+
+func (r *UserRepository) UpdatePasswordHash(id, hash string) error {
+	res, err := r.db.Exec(`UPDATE users SET password_hash = ? WHERE id = ?`, hash, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// 呼び出し側で FindByID 済みの前提。同じ値で更新すると MySQL は 0 行と返すので件数は見ない
+func (r *UserRepository) UpdateEmail(id, email string) error {
+	_, err := r.db.Exec(`UPDATE users SET email = ? WHERE id = ?`, nullIfEmpty(email), id)
+	return err
+}
@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ローカルディスクに置く BlobStore（開発用 / 単一インスタンス用）
+// content type は key の拡張子から決める
+type LocalDisk struct {
+	root string
+}
+
+func NewLocalDisk(root string) (*LocalDisk, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, err
+	}
+	return &LocalDisk{root: root}, nil
+}
+
+func (d *LocalDisk) path(key string) (string, error) {
+	p := filepath.Join(d.root, filepath.FromSlash(key))
+	// ../ で root の外に出ないように
+	if !strings.HasPrefix(p, filepath.Clean(d.root)+string(filepath.Separator)) {
+		return "", errors.New("invalid key")
+	}
+	return p, nil
+}
+
+func (d *LocalDisk) Put(key string, r io.Reader, contentType string) error {
+	p, err := d.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+
+	// 途中で失敗しても壊れたファイルを残さないよう一時ファイル → rename
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+func (d *LocalDisk) Get(key string) (io.ReadCloser, string, error) {
+	p, err := d.path(key)
+	if err != nil {
+		return nil, "", err
+	}
+	f, err := os.Open(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, "", ErrNotFound
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	ct := mime.TypeByExtension(filepath.Ext(p))
+	if ct == "" {
+		ct = "application/octet-stream"
+	}
+	return f, ct, nil
+}
+
+func (d *LocalDisk) Delete(key string) error {
+	p, err := d.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
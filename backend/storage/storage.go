@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"os"
+)
+
+var ErrNotFound = errors.New("blob not found")
+
+// アップロードされたファイルの置き場所。key は "attachments/xxx.jpg" のようなパス
+type BlobStore interface {
+	Put(key string, r io.Reader, contentType string) error
+	// 呼び出し側で Close する
+	Get(key string) (io.ReadCloser, string, error)
+	Delete(key string) error
+}
+
+// STORAGE_BACKEND=local（既定）| s3
+//
+//	local: UPLOAD_DIR（既定 ./uploads）
+//	s3:    S3_ENDPOINT, S3_BUCKET, S3_REGION, S3_ACCESS_KEY, S3_SECRET_KEY
+//	       ローカルでは MinIO（http://localhost:9000）を立てて向ければ同じコードで動く
+func NewFromEnv() (BlobStore, error) {
+	switch os.Getenv("STORAGE_BACKEND") {
+	case "", "local":
+		dir := os.Getenv("UPLOAD_DIR")
+		if dir == "" {
+			dir = "./uploads"
+		}
+		return NewLocalDisk(dir)
+	case "s3":
+		endpoint, bucket := os.Getenv("S3_ENDPOINT"), os.Getenv("S3_BUCKET")
+		if endpoint == "" || bucket == "" {
+			return nil, errors.New("S3_ENDPOINT and S3_BUCKET are required")
+		}
+		return NewS3(
+			endpoint, bucket,
+			os.Getenv("S3_REGION"),
+			os.Getenv("S3_ACCESS_KEY"),
+			os.Getenv("S3_SECRET_KEY"),
+		), nil
+	default:
+		return nil, errors.New("unknown STORAGE_BACKEND")
+	}
+}
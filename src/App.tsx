@@ -9,6 +9,8 @@ import { Signup } from "./components/Signup";
 import { Inbox } from "./components/Inbox"; // パスは君の構成に合わせて
 import { PurchaseConfirm } from "./components/PurchaseConfirm";
 import { PurchaseDone } from "./components/PurchaseDone";
+import { ResetPassword } from "./components/ResetPassword";
+import { SESSION_EXPIRED_EVENT } from "./lib/api";
 
 export type Product = {
     id: string;
@@ -32,6 +34,7 @@ export type Message = {
 export type Screen =
     | { type: "login" }
     | { type: "signup" }
+    | { type: "resetPassword"; token?: string } // token はメールのリンクから
     | { type: "home" }
     | { type: "productDetail"; productId: string }
     | { type: "createListing" }
@@ -50,17 +53,27 @@ export default function App() {
     const hasToken = !!localStorage.getItem("token");
     const initialUserId = localStorage.getItem("userId") ?? "";
 
+    // パスワード再設定メールのリンク（/?token=...）で開かれた
+    const resetToken = new URLSearchParams(window.location.search).get("token");
+
     const [currentScreen, setCurrentScreen] = useState<Screen>(
-        hasToken ? {type: "home"} : {type: "login"}
+        resetToken ? {type: "resetPassword", token: resetToken} : hasToken ? {type: "home"} : {type: "login"}
     );
 
     const [currentUserId, setCurrentUserId] = useState<string>(initialUserId);
 
     // token が消されたらログイン画面へ戻す
     useEffect(() => {
-        if (!localStorage.getItem("token")) {
+        // 再設定トークンは URL に残さない（履歴・リファラに漏れないように）
+        if (resetToken) {
+            window.history.replaceState(null, "", window.location.pathname);
+        } else if (!localStorage.getItem("token")) {
             setCurrentScreen({type: "login"});
         }
+
+        const onExpired = () => setCurrentScreen({type: "login"});
+        window.addEventListener(SESSION_EXPIRED_EVENT, onExpired);
+        return () => window.removeEventListener(SESSION_EXPIRED_EVENT, onExpired);
     }, []);
 
     return (
@@ -103,6 +116,10 @@ export default function App() {
 
                 {currentScreen.type === "signup" && <Signup onNavigate={setCurrentScreen}/>}
 
+                {currentScreen.type === "resetPassword" && (
+                    <ResetPassword token={currentScreen.token} onNavigate={setCurrentScreen}/>
+                )}
+
                 {currentScreen.type === "home" && (
                     <Home onNavigate={setCurrentScreen} currentUserId={currentUserId}/>
                 )}
@@ -50,11 +50,12 @@ export function CreateListing({ onNavigate, currentUserId }: CreateListingProps)
         setError(null);
 
         try {
-            let imageUrl: string | undefined = undefined;
+            const token = localStorage.getItem("token") ?? "";
+            let imageId: string | undefined = undefined;
 
-            // 画像があるなら Firebase Storage へアップロードしてURL取得
+            // 画像があるなら先にアップロードして id をもらう
             if (imageFile) {
-                imageUrl = await uploadImage(imageFile, currentUserId);
+                imageId = (await uploadImage(imageFile, token)).id;
             }
 
             await createProduct({
@@ -62,9 +63,9 @@ export function CreateListing({ onNavigate, currentUserId }: CreateListingProps)
                 price: status === "considering" ? 0 : Number(price),
                 description,
                 sellerId: currentUserId,
-                imageUrl,
+                imageId,
                 status, // ← considering 対応
-            });
+            }, token);
 
             onNavigate({ type: "home" });
         } catch (e: any) {
@@ -1,7 +1,7 @@
 import { useEffect, useMemo, useState, type MouseEvent } from "react";
 import { Search, User, Heart } from "lucide-react";
 import { Screen } from "../App";
-import { fetchProducts, toggleLike } from "../lib/api";
+import { fetchProduct, fetchProducts, toggleLike } from "../lib/api";
 import { mockProducts } from "../lib/mockData";
 
 type HomeProps = {
@@ -10,45 +10,61 @@ type HomeProps = {
 };
 
 export function Home({ onNavigate }: HomeProps) {
-    const [allProducts, setAllProducts] = useState<any[]>([]);
     const [products, setProducts] = useState<any[]>([]);
+    const [nextCursor, setNextCursor] = useState<string | null>(null);
     const [searchQuery, setSearchQuery] = useState("");
     const [loading, setLoading] = useState(true);
+    const [loadingMore, setLoadingMore] = useState(false);
 
     const token = useMemo(() => localStorage.getItem("token") ?? "", []);
+    const keyword = searchQuery.trim();
 
-    // 初回ロード：APIから商品取得（失敗したらmockにフォールバック）
+    // 1ページ目を取得（検索語が変わったら取り直す。失敗したらmockにフォールバック）
     useEffect(() => {
+        let cancelled = false;
         setLoading(true);
-        fetchProducts(token || undefined)
-            .then((data) => {
-                setAllProducts(data);
-                setProducts(data);
-            })
-            .catch((err) => {
-                console.error("fetchProducts failed:", err);
-                setAllProducts(mockProducts as any[]);
-                setProducts(mockProducts as any[]);
-            })
-            .finally(() => setLoading(false));
-    }, [token]);
-
-    // 検索：allProductsをフィルタしてproductsへ反映
-    useEffect(() => {
-        if (!searchQuery.trim()) {
-            setProducts(allProducts);
-            return;
+        const timer = setTimeout(() => {
+            fetchProducts({ q: keyword || undefined }, token || undefined)
+                .then((page) => {
+                    if (cancelled) return;
+                    setProducts(page.products);
+                    setNextCursor(page.nextCursor);
+                })
+                .catch((err) => {
+                    console.error("fetchProducts failed:", err);
+                    if (cancelled) return;
+                    setProducts(mockProducts as any[]);
+                    setNextCursor(null);
+                })
+                .finally(() => {
+                    if (!cancelled) setLoading(false);
+                });
+        }, keyword ? 300 : 0);
+
+        return () => {
+            cancelled = true;
+            clearTimeout(timer);
+        };
+    }, [keyword, token]);
+
+    // もっと見る：X-Next-Cursor の続きを後ろに足す
+    const handleLoadMore = async () => {
+        if (!nextCursor || loadingMore) return;
+        setLoadingMore(true);
+        try {
+            const page = await fetchProducts(
+                { q: keyword || undefined, cursor: nextCursor },
+                token || undefined
+            );
+            setProducts((prev) => [...prev, ...page.products]);
+            setNextCursor(page.nextCursor);
+        } catch (err: any) {
+            console.error(err);
+            alert(err?.message ?? "商品の取得に失敗しました");
+        } finally {
+            setLoadingMore(false);
         }
-
-        const q = searchQuery.toLowerCase();
-        const filtered = allProducts.filter((p) => {
-            const title = (p.title ?? p.name ?? "").toLowerCase();
-            const desc = (p.description ?? "").toLowerCase();
-            return title.includes(q) || desc.includes(q);
-        });
-
-        setProducts(filtered);
-    }, [searchQuery, allProducts]);
+    };
 
     const handleToggleLike = async (e: MouseEvent, productId: string) => {
         e.stopPropagation(); // ← 商品詳細への遷移クリックを止める
@@ -59,7 +75,7 @@ export function Home({ onNavigate }: HomeProps) {
         }
 
         // 楽観的UI更新（先に表示を変える）
-        setAllProducts((prev) =>
+        setProducts((prev) =>
             prev.map((p) => {
                 if (p.id !== productId) return p;
                 const liked = !(p.likedByMe ?? false);
@@ -71,7 +87,7 @@ export function Home({ onNavigate }: HomeProps) {
         try {
             const res = await toggleLike(productId, token);
             // サーバ結果で確定
-            setAllProducts((prev) =>
+            setProducts((prev) =>
                 prev.map((p) =>
                     p.id === productId
                         ? { ...p, likedByMe: res.liked, likeCount: res.likeCount }
@@ -82,11 +98,16 @@ export function Home({ onNavigate }: HomeProps) {
             console.error(err);
             alert(err?.message ?? "いいねに失敗しました");
 
-            // 失敗したら取り直して整合性を戻す
+            // 失敗したらその商品だけ取り直して整合性を戻す
             try {
-                const data = await fetchProducts(token || undefined);
-                setAllProducts(data);
-                // products は searchEffect で追従する
+                const fresh = await fetchProduct(productId, token || undefined);
+                setProducts((prev) =>
+                    prev.map((p) =>
+                        p.id === productId
+                            ? { ...p, likedByMe: fresh.likedByMe, likeCount: fresh.likeCount }
+                            : p
+                    )
+                );
             } catch (e) {
                 console.error(e);
             }
@@ -185,6 +206,17 @@ export function Home({ onNavigate }: HomeProps) {
                     })}
                 </div>
 
+                {!loading && nextCursor && (
+                    <button
+                        type="button"
+                        onClick={handleLoadMore}
+                        disabled={loadingMore}
+                        className="w-full mt-4 h-11 border border-gray-300 rounded-lg text-sm text-gray-700 hover:bg-gray-50 disabled:opacity-50"
+                    >
+                        {loadingMore ? "読み込み中..." : "もっと見る"}
+                    </button>
+                )}
+
                 {!loading && products.length === 0 && (
                     <div className="text-center text-gray-500 py-8">
                         該当する商品がありません
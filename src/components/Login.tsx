@@ -1,5 +1,5 @@
 import { useState } from "react";
-import { login } from "../lib/api";
+import { login, loginWith2fa } from "../lib/api";
 import { Screen } from "../App";
 
 export function Login({ onNavigate }: { onNavigate: (screen: Screen) => void }) {
@@ -7,6 +7,11 @@ export function Login({ onNavigate }: { onNavigate: (screen: Screen) => void })
     const [password, setPassword] = useState("");
     const [error, setError] = useState<string | null>(null);
     const [loading, setLoading] = useState(false);
+    // 2 段階認証の途中（パスワードは通った）
+    const [challengeToken, setChallengeToken] = useState<string | null>(null);
+    const [code, setCode] = useState("");
+    // 認証アプリが使えないときはリカバリーコードで
+    const [useRecovery, setUseRecovery] = useState(false);
 
     const handleLogin = async () => {
         if (!userId || !password) {
@@ -18,8 +23,16 @@ export function Login({ onNavigate }: { onNavigate: (screen: Screen) => void })
         setError(null);
 
         try {
-            const { token } = await login(userId, password);
+            const res = challengeToken
+                ? await loginWith2fa(challengeToken, useRecovery ? { recoveryCode: code } : { code })
+                : await login(userId, password);
+            if ("mfaRequired" in res) {
+                setChallengeToken(res.challengeToken);
+                return;
+            }
+            const { token, refreshToken } = res;
             localStorage.setItem("token", token);
+            localStorage.setItem("refreshToken", refreshToken);
             localStorage.setItem("userId", userId);
             onNavigate({ type: "home" });
         } catch (e: any) {
@@ -51,6 +64,31 @@ export function Login({ onNavigate }: { onNavigate: (screen: Screen) => void })
             />
 
 
+            {challengeToken && (
+                <>
+                    <label className="block mt-4 mb-2 text-gray-700">
+                        {useRecovery ? "リカバリーコード" : "認証アプリのコード（6桁）"}
+                    </label>
+                    <input
+                        inputMode={useRecovery ? "text" : "numeric"}
+                        autoComplete="one-time-code"
+                        className="w-full h-12 px-4 border border-gray-300 rounded-lg outline-none focus:border-blue-600 mb-2"
+                        value={code}
+                        onChange={(e) => setCode(e.target.value)}
+                        placeholder={useRecovery ? "xxxxx-xxxxx" : "123456"}
+                    />
+                    <button
+                        type="button"
+                        onClick={() => {
+                            setUseRecovery(!useRecovery);
+                            setCode("");
+                        }}
+                        className="mb-4 text-sm text-blue-600 hover:underline"
+                    >
+                        {useRecovery ? "認証アプリのコードを使う" : "リカバリーコードを使う"}
+                    </button>
+                </>
+            )}
 
             {error && <div className="mt-3 text-red-500 text-sm">{error}</div>}
 
@@ -71,6 +109,13 @@ export function Login({ onNavigate }: { onNavigate: (screen: Screen) => void })
                 新規登録
             </button>
 
+            <button
+                onClick={() => onNavigate({ type: "resetPassword" })}
+                className="mt-4 w-full text-sm text-blue-600 hover:underline"
+            >
+                パスワードをお忘れの方
+            </button>
+
         </div>
     );
 }
\ No newline at end of file
@@ -1,7 +1,8 @@
 import { useEffect, useState } from "react";
 import { ArrowLeft, Plus } from "lucide-react";
 import { Screen } from "../App";
-import { fetchProducts, fetchMe } from "../lib/api";
+import { fetchProductsBySeller, fetchMe, logout } from "../lib/api";
+import { TwoFactorSettings } from "./TwoFactorSettings";
 
 type MyPageProps = {
     onNavigate: (screen: Screen) => void;
@@ -34,7 +35,10 @@ export function MyPage({ onNavigate, currentUserId }: MyPageProps) {
     const token = localStorage.getItem("token");
 
     const handleLogout = () => {
+        // サーバー側のセッションも失効させる（失敗してもローカルは消す）
+        if (token) logout(token).catch(() => {});
         localStorage.removeItem("token");
+        localStorage.removeItem("refreshToken");
         localStorage.removeItem("userId");
         onNavigate({ type: "login" });
     };
@@ -61,11 +65,8 @@ export function MyPage({ onNavigate, currentUserId }: MyPageProps) {
     // ② 自分の出品一覧を取得
     useEffect(() => {
         setLoadingProducts(true);
-        fetchProducts()
-            .then((data: Product[]) => {
-                const mine = data.filter((p) => p.sellerId === currentUserId);
-                setMyProducts(mine);
-            })
+        fetchProductsBySeller(currentUserId)
+            .then((data: Product[]) => setMyProducts(data))
             .catch((err) => {
                 console.error(err);
                 setMyProducts([]);
@@ -117,6 +118,8 @@ export function MyPage({ onNavigate, currentUserId }: MyPageProps) {
                 </div>
             </div>
 
+            {token && <TwoFactorSettings token={token} />}
+
             {/* User's Listings */}
             <div className="p-4">
                 <div className="flex items-center justify-between mb-4">
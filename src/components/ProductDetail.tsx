@@ -3,7 +3,7 @@ import { ArrowLeft, Heart } from "lucide-react";
 import { Screen } from "../App";
 import { fetchUserById } from "../lib/api";
 import {
-    fetchProducts,
+    fetchProduct,
     purchaseProduct,
     generateProductSummary,
     toggleLike,
@@ -63,11 +63,8 @@ export function ProductDetail({
         setLoading(true);
         setError(null);
 
-        fetchProducts(token || undefined)
-            .then((data: Product[]) => {
-                const found = data.find((p) => p.id === productId) ?? null;
-                setProduct(found);
-            })
+        fetchProduct(productId, token || undefined)
+            .then((data: Product) => setProduct(data))
             .catch((err) => {
                 console.error(err);
                 setError("商品の取得に失敗しました");
@@ -197,9 +194,7 @@ export function ProductDetail({
 
             // 失敗したら取り直す（確実に戻す）
             try {
-                const data: Product[] = await fetchProducts(token || undefined);
-                const found = data.find((p) => p.id === productId) ?? null;
-                setProduct(found);
+                setProduct(await fetchProduct(productId, token || undefined));
             } catch (err) {
                 console.error(err);
             }
@@ -1,7 +1,7 @@
 import { useEffect, useMemo, useState } from "react";
 import { ArrowLeft } from "lucide-react";
 import { Screen } from "../App";
-import { fetchProducts, purchaseProduct, fetchUserById } from "../lib/api";
+import { fetchProduct, purchaseProduct, fetchUserById } from "../lib/api";
 
 type PurchaseConfirmProps = {
     productId: string;
@@ -59,8 +59,7 @@ export function PurchaseConfirm({
 
             try {
                 // ここは修正なし: tokenがなくても商品取得を試みる
-                const products = await fetchProducts(token || undefined);
-                const p = (products as Product[]).find((x) => x.id === productId) ?? null;
+                const p: Product = await fetchProduct(productId, token || undefined);
 
                 if (cancelled) return;
                 setProduct(p);
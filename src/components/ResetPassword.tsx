@@ -0,0 +1,123 @@
+import { useState } from "react";
+import { confirmPasswordReset, requestPasswordReset } from "../lib/api";
+import { Screen } from "../App";
+
+// token なし: メールアドレスを入れて再設定メールを送る
+// token あり（メールのリンクから）: 新しいパスワードを決める
+export function ResetPassword({
+    token,
+    onNavigate,
+}: {
+    token?: string;
+    onNavigate: (screen: Screen) => void;
+}) {
+    const [email, setEmail] = useState("");
+    const [password, setPassword] = useState("");
+    const [confirm, setConfirm] = useState("");
+
+    const [error, setError] = useState<string | null>(null);
+    const [done, setDone] = useState(false);
+    const [loading, setLoading] = useState(false);
+
+    const handleSubmit = async () => {
+        setError(null);
+
+        if (token) {
+            if (!password) {
+                setError("新しいパスワードを入力してください");
+                return;
+            }
+            if (password !== confirm) {
+                setError("パスワードが一致しません");
+                return;
+            }
+        } else if (!email) {
+            setError("メールアドレスを入力してください");
+            return;
+        }
+
+        setLoading(true);
+        try {
+            if (token) {
+                await confirmPasswordReset(token, password);
+                // 再設定するとすべての端末でログアウトされる
+                localStorage.removeItem("token");
+                localStorage.removeItem("refreshToken");
+            } else {
+                await requestPasswordReset(email);
+            }
+            setDone(true);
+        } catch (e: any) {
+            setError(e?.message ?? "failed");
+        } finally {
+            setLoading(false);
+        }
+    };
+
+    return (
+        <div className="max-w-md mx-auto min-h-screen bg-white p-6">
+            <h1 className="text-xl mb-6">パスワード再設定</h1>
+
+            {done ? (
+                <p className="text-gray-700">
+                    {token
+                        ? "パスワードを変更しました。新しいパスワードでログインしてください。"
+                        : "登録されているメールアドレスであれば、再設定用のリンクを送りました（30 分間有効）。"}
+                </p>
+            ) : token ? (
+                <>
+                    <label className="block mb-2 text-gray-700">新しいパスワード</label>
+                    <input
+                        type="password"
+                        autoComplete="new-password"
+                        className="w-full h-12 px-4 border border-gray-300 rounded-lg outline-none focus:border-blue-600"
+                        value={password}
+                        onChange={(e) => setPassword(e.target.value)}
+                    />
+
+                    <label className="block mt-4 mb-2 text-gray-700">新しいパスワード（確認）</label>
+                    <input
+                        type="password"
+                        autoComplete="new-password"
+                        className="w-full h-12 px-4 border border-gray-300 rounded-lg outline-none focus:border-blue-600"
+                        value={confirm}
+                        onChange={(e) => setConfirm(e.target.value)}
+                    />
+                </>
+            ) : (
+                <>
+                    <label className="block mb-2 text-gray-700">登録したメールアドレス</label>
+                    <input
+                        type="email"
+                        autoComplete="email"
+                        className="w-full h-12 px-4 border border-gray-300 rounded-lg outline-none focus:border-blue-600"
+                        value={email}
+                        onChange={(e) => setEmail(e.target.value)}
+                        placeholder="you@example.com"
+                    />
+                </>
+            )}
+
+            {error && <div className="mt-3 text-red-500 text-sm">{error}</div>}
+
+            {!done && (
+                <button
+                    onClick={handleSubmit}
+                    disabled={loading}
+                    className={`mt-6 w-full h-12 text-white rounded-lg ${
+                        loading ? "bg-gray-400" : "bg-blue-600 hover:bg-blue-700"
+                    }`}
+                >
+                    {loading ? "送信中..." : token ? "パスワードを変更" : "再設定メールを送る"}
+                </button>
+            )}
+
+            <button
+                onClick={() => onNavigate({ type: "login" })}
+                className="mt-4 w-full h-12 border border-gray-300 rounded-lg hover:bg-gray-50"
+            >
+                ログイン画面へ戻る
+            </button>
+        </div>
+    );
+}
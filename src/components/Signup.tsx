@@ -32,9 +32,12 @@ export function Signup({ onNavigate }: { onNavigate: (screen: Screen) => void })
             await signup(userId, password, displayName, mbti);
 
             // UX向上：登録後そのままログイン
-            const { token } = await login(userId, password);
+            const res = await login(userId, password);
+            if ("mfaRequired" in res) throw new Error("login failed");
+            const { token, refreshToken } = res;
 
             localStorage.setItem("token", token);
+            localStorage.setItem("refreshToken", refreshToken);
             localStorage.setItem("userId", userId);
             localStorage.setItem("displayName", displayName);
             localStorage.setItem("mbti", mbti);
@@ -0,0 +1,183 @@
+import { useEffect, useState } from "react";
+import { confirm2fa, disable2fa, enroll2fa, fetch2faStatus } from "../lib/api";
+
+// マイページの 2 段階認証（TOTP）設定
+// enroll → 認証アプリに登録 → コードで confirm すると有効になり、リカバリーコードが 1 回だけ表示される
+export function TwoFactorSettings({ token }: { token: string }) {
+    const [enabled, setEnabled] = useState<boolean | null>(null);
+    const [enrollment, setEnrollment] = useState<{ secret: string; otpauthUri: string } | null>(null);
+    const [recoveryCodes, setRecoveryCodes] = useState<string[] | null>(null);
+    const [disabling, setDisabling] = useState(false);
+    const [useRecovery, setUseRecovery] = useState(false);
+    const [code, setCode] = useState("");
+
+    const [error, setError] = useState<string | null>(null);
+    const [loading, setLoading] = useState(false);
+
+    useEffect(() => {
+        fetch2faStatus(token)
+            .then((s) => setEnabled(s.enabled))
+            .catch((err) => {
+                console.error(err);
+                setEnabled(null);
+            });
+    }, [token]);
+
+    const run = async (fn: () => Promise<void>) => {
+        setLoading(true);
+        setError(null);
+        try {
+            await fn();
+        } catch (e: any) {
+            setError(e?.message ?? "failed");
+        } finally {
+            setLoading(false);
+        }
+    };
+
+    const handleEnroll = () =>
+        run(async () => {
+            setRecoveryCodes(null);
+            setEnrollment(await enroll2fa(token));
+            setCode("");
+        });
+
+    const handleConfirm = () =>
+        run(async () => {
+            const res = await confirm2fa(code, token);
+            setEnrollment(null);
+            setRecoveryCodes(res.recoveryCodes);
+            setEnabled(true);
+            setCode("");
+        });
+
+    const handleDisable = () =>
+        run(async () => {
+            await disable2fa(useRecovery ? { recoveryCode: code } : { code }, token);
+            setDisabling(false);
+            setEnabled(false);
+            setCode("");
+        });
+
+    const codeInput = (placeholder: string) => (
+        <input
+            inputMode={useRecovery ? "text" : "numeric"}
+            autoComplete="one-time-code"
+            className="w-full h-10 px-3 border border-gray-300 rounded-lg outline-none focus:border-blue-600"
+            value={code}
+            onChange={(e) => setCode(e.target.value)}
+            placeholder={placeholder}
+        />
+    );
+
+    if (enabled === null) return null;
+
+    return (
+        <div className="p-6 border-b border-gray-200">
+            <div className="flex items-center justify-between">
+                <div>
+                    <div className="text-gray-600 text-sm">2 段階認証</div>
+                    <div className="mt-1">{enabled ? "有効" : "無効"}</div>
+                </div>
+
+                {!enabled && !enrollment && (
+                    <button
+                        onClick={handleEnroll}
+                        disabled={loading}
+                        className="text-sm px-4 py-2 border border-blue-600 text-blue-600 rounded-lg hover:bg-blue-50"
+                    >
+                        設定する
+                    </button>
+                )}
+                {enabled && !disabling && (
+                    <button
+                        onClick={() => {
+                            setDisabling(true);
+                            setRecoveryCodes(null);
+                            setCode("");
+                        }}
+                        className="text-sm px-4 py-2 border border-gray-300 rounded-lg hover:bg-gray-50"
+                    >
+                        無効にする
+                    </button>
+                )}
+            </div>
+
+            {enrollment && (
+                <div className="mt-4 space-y-3">
+                    <div className="text-sm text-gray-700">
+                        認証アプリに次のキーを登録し、表示された 6 桁のコードを入力してください。
+                    </div>
+                    <a href={enrollment.otpauthUri} className="block text-sm text-blue-600 hover:underline">
+                        認証アプリで開く
+                    </a>
+                    <div className="p-3 rounded-lg bg-gray-50 border font-mono text-sm break-all">
+                        {enrollment.secret}
+                    </div>
+                    {codeInput("123456")}
+                    <button
+                        onClick={handleConfirm}
+                        disabled={loading || !code}
+                        className={`w-full h-10 text-white rounded-lg ${
+                            loading ? "bg-gray-400" : "bg-blue-600 hover:bg-blue-700"
+                        }`}
+                    >
+                        有効にする
+                    </button>
+                </div>
+            )}
+
+            {recoveryCodes && (
+                <div className="mt-4">
+                    <div className="text-sm text-gray-700">
+                        リカバリーコードです。認証アプリが使えなくなったときに 1 つずつ使えます。
+                        この画面を離れると二度と表示されないので、安全な場所に控えてください。
+                    </div>
+                    <div className="mt-2 p-3 rounded-lg bg-gray-50 border grid grid-cols-2 gap-1 font-mono text-sm">
+                        {recoveryCodes.map((c) => (
+                            <div key={c}>{c}</div>
+                        ))}
+                    </div>
+                </div>
+            )}
+
+            {disabling && (
+                <div className="mt-4 space-y-3">
+                    <div className="text-sm text-gray-700">
+                        {useRecovery ? "リカバリーコード" : "認証アプリのコード（6桁）"}を入力してください。
+                    </div>
+                    {codeInput(useRecovery ? "xxxxx-xxxxx" : "123456")}
+                    <button
+                        type="button"
+                        onClick={() => {
+                            setUseRecovery(!useRecovery);
+                            setCode("");
+                        }}
+                        className="text-sm text-blue-600 hover:underline"
+                    >
+                        {useRecovery ? "認証アプリのコードを使う" : "リカバリーコードを使う"}
+                    </button>
+                    <div className="grid grid-cols-2 gap-3">
+                        <button
+                            onClick={() => setDisabling(false)}
+                            className="h-10 border border-gray-300 rounded-lg hover:bg-gray-50"
+                        >
+                            キャンセル
+                        </button>
+                        <button
+                            onClick={handleDisable}
+                            disabled={loading || !code}
+                            className={`h-10 text-white rounded-lg ${
+                                loading ? "bg-gray-400" : "bg-red-500 hover:bg-red-600"
+                            }`}
+                        >
+                            無効にする
+                        </button>
+                    </div>
+                </div>
+            )}
+
+            {error && <div className="mt-3 text-red-500 text-sm">{error}</div>}
+        </div>
+    );
+}
@@ -18,18 +18,60 @@ export type UserProfile = {
     userId: string;
     displayName: string;
     mbti: string;
+    rating?: number | null;
+    reviewCount?: number;
 };
 
-export async function fetchProducts(token?: string) {
+export type ProductPage = { products: Product[]; nextCursor: string | null };
+
+// GET /products は 1 ページずつ返る。続きは X-Next-Cursor を cursor に渡して取る
+export async function fetchProducts(
+    params: { q?: string; sellerId?: string; cursor?: string } = {},
+    token?: string
+): Promise<ProductPage> {
+    const headers: HeadersInit = { "Content-Type": "application/json" };
+
+    const qs = new URLSearchParams();
+    if (params.q) qs.set("q", params.q);
+    if (params.sellerId) qs.set("sellerId", params.sellerId);
+    if (params.cursor) qs.set("cursor", params.cursor);
+    const url = qs.toString() ? `${API_BASE}/products?${qs}` : `${API_BASE}/products`;
+
+    const res = token
+        ? await authFetch(url, { headers }, token)
+        : await fetch(url, { headers });
+    if (!res.ok) {
+        const text = await res.text();
+        throw new Error(text || `failed to fetch (${res.status})`);
+    }
+    const products = (await res.json()) as Product[];
+    return { products, nextCursor: res.headers.get("X-Next-Cursor") };
+}
+
+// 出品者の商品を最後のページまで取る（マイページ用）
+export async function fetchProductsBySeller(sellerId: string, token?: string) {
+    const all: Product[] = [];
+    let cursor: string | undefined;
+    do {
+        const page = await fetchProducts({ sellerId, cursor }, token);
+        all.push(...page.products);
+        cursor = page.nextCursor ?? undefined;
+    } while (cursor);
+    return all;
+}
+
+export async function fetchProduct(productId: string, token?: string) {
     const headers: HeadersInit = { "Content-Type": "application/json" };
-    if (token) headers.Authorization = `Bearer ${token}`;
+    const url = `${API_BASE}/products/${productId}`;
 
-    const res = await fetch(`${API_BASE}/products`, { headers });
+    const res = token
+        ? await authFetch(url, { headers }, token)
+        : await fetch(url, { headers });
     if (!res.ok) {
         const text = await res.text();
         throw new Error(text || `failed to fetch (${res.status})`);
     }
-    return res.json() as Promise<Product[]>;
+    return res.json() as Promise<Product>;
 }
 
 export async function createProduct(product: {
@@ -37,14 +79,14 @@ export async function createProduct(product: {
     price: number;
     description: string;
     sellerId: string;
-    imageUrl?: string;
+    imageId?: string; // uploadImage で上げた画像
     status?: "available" | "considering";
-}) {
-    const res = await fetch(`${API_BASE}/products`, {
+}, token: string) {
+    const res = await authFetch(`${API_BASE}/products`, {
         method: "POST",
         headers: { "Content-Type": "application/json" },
         body: JSON.stringify(product),
-    });
+    }, token);
 
     if (!res.ok) {
         const text = await res.text();
@@ -54,14 +96,11 @@ export async function createProduct(product: {
 }
 
 export async function purchaseProduct(productId: string, token: string) {
-    const res = await fetch(`${API_BASE}/purchase`, {
+    const res = await authFetch(`${API_BASE}/purchase`, {
         method: "POST",
-        headers: {
-            "Content-Type": "application/json",
-            Authorization: `Bearer ${token}`,
-        },
+        headers: { "Content-Type": "application/json" },
         body: JSON.stringify({ productId }),
-    });
+    }, token);
 
     if (!res.ok) {
         const text = await res.text();
@@ -100,14 +139,134 @@ export async function login(userId: string, password: string) {
         const text = await res.text();
         throw new Error(text || "login failed");
     }
-    return res.json() as Promise<{ token: string }>;
+    return res.json() as Promise<LoginResponse>;
 }
 
-export async function fetchMe(token: string) {
-    const res = await fetch(`${API_BASE}/me`, {
-        headers: { Authorization: `Bearer ${token}` },
+// 2 段階認証を有効にしている場合、/login はトークンの代わりにチャレンジを返す
+export type LoginResponse =
+    | TokenResponse
+    | { mfaRequired: true; challengeToken: string; expiresIn: number };
+
+// 認証アプリのコードか、なくしたときはリカバリーコード（1 回限り）のどちらか
+export async function loginWith2fa(
+    challengeToken: string,
+    second: { code: string } | { recoveryCode: string }
+) {
+    const res = await fetch(`${API_BASE}/login/2fa`, {
+        method: "POST",
+        headers: { "Content-Type": "application/json" },
+        body: JSON.stringify({ challengeToken, ...second }),
     });
 
+    if (!res.ok) {
+        const text = await res.text();
+        throw new Error(text || "2fa login failed");
+    }
+    return res.json() as Promise<TokenResponse>;
+}
+
+// token: アクセストークン（短命） / refreshToken: /token/refresh で 1 回だけ使える
+export type TokenResponse = { token: string; refreshToken: string; expiresIn: number };
+
+// リフレッシュもできずにログアウト扱いになったとき window に投げる（App がログイン画面へ戻す）
+export const SESSION_EXPIRED_EVENT = "session-expired";
+
+// 同時に 401 が返っても /token/refresh は 1 回だけ投げる（リフレッシュトークンは使い捨て）
+let refreshing: Promise<string | null> | null = null;
+
+function refreshAccessToken() {
+    if (!refreshing) {
+        refreshing = (async () => {
+            const refreshToken = localStorage.getItem("refreshToken");
+            if (!refreshToken) return null;
+
+            const res = await fetch(`${API_BASE}/token/refresh`, {
+                method: "POST",
+                headers: { "Content-Type": "application/json" },
+                body: JSON.stringify({ refreshToken }),
+            });
+            if (!res.ok) {
+                // 失効・再利用検知。通信エラー（fetch が throw）では消さない
+                if (res.status === 401) {
+                    localStorage.removeItem("token");
+                    localStorage.removeItem("refreshToken");
+                    window.dispatchEvent(new Event(SESSION_EXPIRED_EVENT));
+                }
+                return null;
+            }
+
+            const t = (await res.json()) as TokenResponse;
+            localStorage.setItem("token", t.token);
+            localStorage.setItem("refreshToken", t.refreshToken);
+            return t.token;
+        })().finally(() => {
+            refreshing = null;
+        });
+    }
+    return refreshing;
+}
+
+// 認証つき fetch。アクセストークンが切れて 401 なら取り直して 1 回だけやり直す
+// 画面側が覚えている token は古いことがあるので localStorage の最新を優先する
+export async function authFetch(url: string, init: RequestInit, token: string) {
+    const send = (t: string) => {
+        const headers = new Headers(init.headers);
+        headers.set("Authorization", `Bearer ${t}`);
+        return fetch(url, { ...init, headers });
+    };
+
+    const current = localStorage.getItem("token") || token;
+    const res = await send(current);
+    if (res.status !== 401) return res;
+
+    // 他のリクエストが先に取り直していればそれを使う
+    const latest = localStorage.getItem("token");
+    const next = latest && latest !== current ? latest : await refreshAccessToken().catch(() => null);
+    return next ? send(next) : res;
+}
+
+export async function logout(token: string) {
+    const res = await authFetch(`${API_BASE}/logout`, {
+        method: "POST",
+    }, token);
+
+    if (!res.ok) {
+        const text = await res.text();
+        throw new Error(text || "logout failed");
+    }
+}
+
+// パスワード再設定。登録の有無にかかわらず受け付ける（メールが届くのは登録済みのときだけ）
+export async function requestPasswordReset(email: string) {
+    const res = await fetch(`${API_BASE}/password-reset/request`, {
+        method: "POST",
+        headers: { "Content-Type": "application/json" },
+        body: JSON.stringify({ email }),
+    });
+
+    if (!res.ok) {
+        const text = await res.text();
+        throw new Error(text || "failed to request password reset");
+    }
+}
+
+// メールのリンク（?token=）で開いた画面から
+export async function confirmPasswordReset(token: string, newPassword: string) {
+    const res = await fetch(`${API_BASE}/password-reset/confirm`, {
+        method: "POST",
+        headers: { "Content-Type": "application/json" },
+        body: JSON.stringify({ token, newPassword }),
+    });
+
+    if (!res.ok) {
+        const text = await res.text();
+        throw new Error(text || "failed to reset password");
+    }
+}
+
+export async function fetchMe(token: string) {
+    const res = await authFetch(`${API_BASE}/me`, {}, token);
+
     if (!res.ok) {
         const text = await res.text();
         throw new Error(text || "failed to fetch me");
@@ -115,6 +274,56 @@ export async function fetchMe(token: string) {
     return (await res.json()) as UserProfile;
 }
 
+// 2 段階認証の設定
+export async function fetch2faStatus(token: string) {
+    const res = await authFetch(`${API_BASE}/me/2fa`, {}, token);
+
+    if (!res.ok) {
+        const text = await res.text();
+        throw new Error(text || "failed to fetch 2fa settings");
+    }
+    return res.json() as Promise<{ enabled: boolean }>;
+}
+
+// シークレットを発行するだけ。confirm でコードが通るまでは有効にならない
+export async function enroll2fa(token: string) {
+    const res = await authFetch(`${API_BASE}/me/2fa/enroll`, { method: "POST" }, token);
+
+    if (!res.ok) {
+        const text = await res.text();
+        throw new Error(text || "failed to start 2fa enrollment");
+    }
+    return res.json() as Promise<{ secret: string; otpauthUri: string }>;
+}
+
+// リカバリーコードはこのレスポンスでしか返らない
+export async function confirm2fa(code: string, token: string) {
+    const res = await authFetch(`${API_BASE}/me/2fa/confirm`, {
+        method: "POST",
+        headers: { "Content-Type": "application/json" },
+        body: JSON.stringify({ code }),
+    }, token);
+
+    if (!res.ok) {
+        const text = await res.text();
+        throw new Error(text || "failed to enable 2fa");
+    }
+    return res.json() as Promise<{ enabled: true; recoveryCodes: string[] }>;
+}
+
+export async function disable2fa(second: { code: string } | { recoveryCode: string }, token: string) {
+    const res = await authFetch(`${API_BASE}/me/2fa/disable`, {
+        method: "POST",
+        headers: { "Content-Type": "application/json" },
+        body: JSON.stringify(second),
+    }, token);
+
+    if (!res.ok) {
+        const text = await res.text();
+        throw new Error(text || "failed to disable 2fa");
+    }
+}
+
 export async function fetchUserById(userId: string) {
     const res = await fetch(`${API_BASE}/users/${userId}`);
 
@@ -149,14 +358,11 @@ export async function fetchMbtiAdvice(
     buyerMbti: string,
     token: string
 ) {
-    const res = await fetch(`${API_BASE}/ai/mbti-advice`, {
+    const res = await authFetch(`${API_BASE}/ai/mbti-advice`, {
         method: "POST",
-        headers: {
-            "Content-Type": "application/json",
-            Authorization: `Bearer ${token}`,
-        },
+        headers: { "Content-Type": "application/json" },
         body: JSON.stringify({ sellerName, sellerMbti, buyerMbti }),
-    });
+    }, token);
 
     if (!res.ok) {
         const t = await res.text().catch(() => "");
@@ -168,9 +374,10 @@ export async function fetchMbtiAdvice(
 
 // DM
 export async function fetchMessages(otherUserId: string, productId: string, token: string) {
-    const res = await fetch(
+    const res = await authFetch(
         `${API_BASE}/messages?otherUserId=${encodeURIComponent(otherUserId)}&productId=${encodeURIComponent(productId)}`,
-        { headers: { Authorization: `Bearer ${token}` } }
+        {},
+        token
     );
 
     if (!res.ok) {
@@ -184,14 +391,11 @@ export async function fetchMessages(otherUserId: string, productId: string, toke
 }
 
 export async function sendMessage(toUserId: string, productId: string, body: string, token: string) {
-    const res = await fetch(`${API_BASE}/messages`, {
+    const res = await authFetch(`${API_BASE}/messages`, {
         method: "POST",
-        headers: {
-            "Content-Type": "application/json",
-            Authorization: `Bearer ${token}`,
-        },
+        headers: { "Content-Type": "application/json" },
         body: JSON.stringify({ toUserId, productId, body }),
-    });
+    }, token);
 
     if (!res.ok) {
         const text = await res.text();
@@ -209,9 +413,7 @@ export async function sendMessage(toUserId: string, productId: string, body: str
 }
 
 export async function fetchProductChats(productId: string, token: string) {
-    const res = await fetch(`${API_BASE}/product-chats?productId=${encodeURIComponent(productId)}`, {
-        headers: { Authorization: `Bearer ${token}` },
-    });
+    const res = await authFetch(`${API_BASE}/product-chats?productId=${encodeURIComponent(productId)}`, {}, token);
 
     const text = await res.text();
     if (!res.ok) throw new Error(text || "failed to fetch product chats");
@@ -219,14 +421,11 @@ export async function fetchProductChats(productId: string, token: string) {
 }
 
 export async function toggleLike(productId: string, token: string) {
-    const res = await fetch(`${API_BASE}/likes`, {
+    const res = await authFetch(`${API_BASE}/likes`, {
         method: "POST",
-        headers: {
-            "Content-Type": "application/json",
-            Authorization: `Bearer ${token}`,
-        },
+        headers: { "Content-Type": "application/json" },
         body: JSON.stringify({ productId }),
-    });
+    }, token);
 
     const text = await res.text();
     if (!res.ok) throw new Error(text || "failed to toggle like");
@@ -1,12 +1,24 @@
-import { ref, uploadBytes, getDownloadURL } from "firebase/storage";
-import { storage } from "./firebase";
+import { authFetch } from "./api";
 
-export async function uploadImage(file: File, userId: string) {
-    const path = `products/${userId}/${Date.now()}_${file.name}`;
-    const storageRef = ref(storage, path);
+const API_BASE = import.meta.env.VITE_API_BASE;
 
-    const snap = await uploadBytes(storageRef, file);
-    const url = await getDownloadURL(snap.ref);
+export type UploadedImage = {
+    id: string;
+    thumbUrl: string;
+    detailUrl: string;
+};
 
-    return url; // ← これを imageUrl として backend に保存する
-}
\ No newline at end of file
+// 出品画像は backend（POST /uploads）に上げる。縮小・保存は backend 側
+// 返ってきた id を商品の imageId にする
+export async function uploadImage(file: File, token: string) {
+    const form = new FormData();
+    form.append("file", file);
+
+    const res = await authFetch(`${API_BASE}/uploads`, { method: "POST", body: form }, token);
+
+    if (!res.ok) {
+        const text = await res.text();
+        throw new Error(text || "failed to upload image");
+    }
+    return res.json() as Promise<UploadedImage>;
+}